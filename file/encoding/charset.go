@@ -0,0 +1,259 @@
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	textencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+	"golang.org/x/text/transform"
+)
+
+// DefaultSniffLen is the length of content used by Detect
+const DefaultSniffLen = 4096
+
+// Result is the charset detected from the beginning of a content
+type Result struct {
+	Name       string                // IANA charset name, empty when the content isn't text
+	Encoding   textencoding.Encoding // Decodes the content from its start, BOM included. Nil when the content isn't text
+	BOMLen     int                   // Length of the byte order mark that starts the content
+	Confidence float64               // From 0 (no idea) to 1 (certain)
+	IsBinary   bool                  // The content isn't text
+}
+
+var (
+	utf8Result    = Result{Name: "UTF-8", Encoding: unicode.UTF8}
+	utf16beResult = Result{Name: "UTF-16BE", Encoding: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)}
+	utf16leResult = Result{Name: "UTF-16LE", Encoding: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)}
+	utf32beResult = Result{Name: "UTF-32BE", Encoding: utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM)}
+	utf32leResult = Result{Name: "UTF-32LE", Encoding: utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM)}
+	cp1252Result  = Result{Name: "windows-1252", Encoding: charmap.Windows1252}
+	latin1Result  = Result{Name: "ISO-8859-1", Encoding: charmap.ISO8859_1}
+)
+
+// Detect peeks the beginning of r to detect its charset. The returned reader
+// replays the peeked bytes, BOM included, followed by the rest of r.
+func Detect(r io.Reader) (Result, io.Reader, error) {
+	return Sniff(r, DefaultSniffLen)
+}
+
+// Sniff is like Detect, peeking n bytes of r.
+func Sniff(r io.Reader, n int) (Result, io.Reader, error) {
+	if n <= 0 {
+		n = DefaultSniffLen
+	}
+	b := bufio.NewReaderSize(r, n)
+	data, err := b.Peek(n)
+	if err != nil && err != io.EOF {
+		return Result{}, b, errors.Wrap(err, "Can't detect charset")
+	}
+	return sniff(data, len(data) == n), b, nil
+}
+
+// IsBinary tells if data, the beginning of a content, isn't text.
+// Text may be in any charset recognized by Detect.
+func IsBinary(data []byte) bool {
+	return sniff(data, true).IsBinary
+}
+
+// IsText tells if data, the beginning of a content, is text
+func IsText(data []byte) bool {
+	return !IsBinary(data)
+}
+
+// Decode gives a reader of r content converted into UTF-8, r being read from
+// the start of the content. The BOM is removed, and binary content is given as is.
+func (res Result) Decode(r io.Reader) io.Reader {
+	if res.IsBinary || res.Encoding == nil || res.Encoding == unicode.UTF8 {
+		return r
+	}
+	return transform.NewReader(r, res.Encoding.NewDecoder())
+}
+
+// sniff guesses the charset of data. Byte order marks are trusted,
+// otherwise the null bytes pattern reveals UTF-32 or UTF-16, then UTF-8 validity is
+// checked, and finally single byte code pages are weighted. Data is truncated
+// when it's only the beginning of the content.
+func sniff(data []byte, truncated bool) Result {
+	if res, ok := detectBOM(data); ok {
+		return res
+	}
+	if res, ok := detectUTF32(data); ok {
+		return res
+	}
+	if res, ok := detectUTF16(data); ok {
+		return res
+	}
+	// NULs padding the end of a text don't make it binary
+	if text := bytes.TrimRight(data, "\x00"); len(text) > 0 {
+		truncated = truncated && len(text) == len(data)
+		data = text
+	}
+	if hasControls(data) {
+		return Result{IsBinary: true}
+	}
+	if res, ok := detectUTF8(data, truncated); ok {
+		return res
+	}
+	return detectSingleByte(data)
+}
+
+// detectUTF32 recognizes UTF-32 without BOM by its null bytes: latin text
+// has three null bytes out of four, the non null one being the last for
+// big endian, the first for little endian.
+func detectUTF32(data []byte) (Result, bool) {
+	quads := len(data) / 4
+	if quads < 2 {
+		return Result{}, false
+	}
+	zeros := [4]int{}
+	for i := 0; i+3 < len(data); i += 4 {
+		for j := range zeros {
+			if data[i+j] == 0 {
+				zeros[j]++
+			}
+		}
+	}
+	ratio := func(j int) float64 { return float64(zeros[j]) / float64(quads) }
+	var res Result
+	switch {
+	case ratio(0) == 1 && ratio(1) >= 0.9 && ratio(3) < 0.1:
+		res = utf32beResult
+		res.Confidence = ratio(1) - ratio(3)
+	case ratio(3) == 1 && ratio(2) >= 0.9 && ratio(0) < 0.1:
+		res = utf32leResult
+		res.Confidence = ratio(2) - ratio(0)
+	default:
+		return Result{}, false
+	}
+	return res, true
+}
+
+// detectUTF16 recognizes UTF-16 without BOM by its null bytes: latin text
+// has a null byte in every other position.
+func detectUTF16(data []byte) (Result, bool) {
+	pairs := len(data) / 2
+	if pairs < 2 {
+		return Result{}, false
+	}
+	even, odd := 0, 0
+	for i := 0; i+1 < len(data); i += 2 {
+		if data[i] == 0 {
+			even++
+		}
+		if data[i+1] == 0 {
+			odd++
+		}
+	}
+	evenRatio, oddRatio := float64(even)/float64(pairs), float64(odd)/float64(pairs)
+	var res Result
+	switch {
+	case evenRatio >= 0.5 && oddRatio < 0.1:
+		res = utf16beResult
+		res.Confidence = evenRatio - oddRatio
+	case oddRatio >= 0.5 && evenRatio < 0.1:
+		res = utf16leResult
+		res.Confidence = oddRatio - evenRatio
+	default:
+		return Result{}, false
+	}
+	return res, true
+}
+
+// hasControls tells if data has null bytes, or too many control characters to be text
+func hasControls(data []byte) bool {
+	controls := 0
+	for _, b := range data {
+		switch {
+		case b == 0:
+			return true
+		case b <= 0x08, b == 0x0B, 0x0E <= b && b <= 0x1A, 0x1C <= b && b <= 0x1F:
+			controls++
+		}
+	}
+	return len(data) > 0 && float64(controls)/float64(len(data)) > 0.05
+}
+
+// detectUTF8 checks that data is UTF-8. The confidence grows with
+// the number of multi-byte sequences, that are unlikely in other charsets.
+// A few invalid sequences among many valid ones lower the confidence.
+// A sequence cut by the end of truncated data is ignored.
+func detectUTF8(data []byte, truncated bool) (Result, bool) {
+	multi, invalid := 0, 0
+	for i := 0; i < len(data); {
+		if data[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			if truncated && !utf8.FullRune(data[i:]) {
+				break
+			}
+			invalid++
+			i++
+			continue
+		}
+		multi++
+		i += size
+	}
+	if invalid > 0 && multi < 4*invalid {
+		return Result{}, false
+	}
+	res := utf8Result
+	res.Confidence = 1
+	if multi > 0 {
+		res.Confidence = math.Max(0.75, 1-math.Pow(0.25, float64(multi)))
+	}
+	if invalid > 0 {
+		res.Confidence *= 0.75 * float64(multi-invalid) / float64(multi)
+	}
+	return res, true
+}
+
+// detectSingleByte chooses between Windows-1252 and ISO-8859-1. Bytes 0x80
+// to 0x9F are printable in Windows-1252 but control characters in ISO-8859-1.
+// The confidence is given by the share of high bytes that look like accented
+// letters within words.
+func detectSingleByte(data []byte) Result {
+	high, c1, undefined, plausible := 0, 0, 0, 0
+	for i, b := range data {
+		if b < 0x80 {
+			continue
+		}
+		high++
+		switch {
+		case b == 0x81, b == 0x8D, b == 0x8F, b == 0x90, b == 0x9D:
+			undefined++
+		case b <= 0x9F:
+			c1++
+			plausible++ // typographic quotes, dashes, euro sign...
+		case b >= 0xC0 && b != 0xD7 && b != 0xF7:
+			if (i > 0 && isLetter(data[i-1])) || (i+1 < len(data) && isLetter(data[i+1])) {
+				plausible++
+			}
+		case b == 0xA0, b == 0xAB, b == 0xBB, b == 0xB0, b == 0xA9:
+			plausible++ // no-break space, guillemets, degree, copyright
+		}
+	}
+	res := latin1Result
+	if c1 > 0 && undefined == 0 {
+		res = cp1252Result
+	}
+	res.Confidence = 0.4
+	if high > 0 {
+		res.Confidence += 0.5 * float64(plausible) / float64(high)
+	}
+	return res
+}
+
+// isLetter tells if b is an ASCII or a latin letter
+func isLetter(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || b >= 0xC0 && b != 0xD7 && b != 0xF7
+}
@@ -0,0 +1,158 @@
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDetectCharset(t *testing.T) {
+	le, err := ioutil.ReadFile("testfiles/utf16-le.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	be, err := ioutil.ReadFile("testfiles/utf16-be.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utf8, err := ioutil.ReadFile("testfiles/utf8.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	le32, err := ioutil.ReadFile("testfiles/utf32-le.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	be32, err := ioutil.ReadFile("testfiles/utf32-be.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name          string
+		data          []byte
+		charset       string
+		bomLen        int
+		minConfidence float64
+	}{
+		{"utf-16le with BOM", le, "UTF-16LE", 2, 1},
+		{"utf-16le", le[2:], "UTF-16LE", 0, 0.9},
+		{"utf-16be", be[2:], "UTF-16BE", 0, 0.9},
+		{"utf-32le with BOM", le32, "UTF-32LE", 4, 1},
+		{"utf-32be with BOM", be32, "UTF-32BE", 4, 1},
+		{"utf-32le", le32[4:], "UTF-32LE", 0, 0.9},
+		{"utf-32be", be32[4:], "UTF-32BE", 0, 0.9},
+		{"utf-8 with BOM", utf8, "UTF-8", 3, 1},
+		{"ascii", utf8[3:200], "UTF-8", 0, 1},
+		{"utf-8", []byte("Voilà l'été, déjà"), "UTF-8", 0, 0.9},
+		{"utf-8 cut", append(bytes.Repeat([]byte("a"), DefaultSniffLen-1), "é"...), "UTF-8", 0, 1},
+		{"windows-1252", []byte("Il a dit \x93bonjour\x94 pour 5 \x80"), "windows-1252", 0, 0.8},
+		{"iso-8859-1", []byte("Caf\xe9 cr\xe8me br\xfbl\xe9e"), "ISO-8859-1", 0, 0.8},
+		{"binary", []byte("\x7fELF\x02\x01\x01\x00\x00\x00"), "", 0, 0},
+	}
+	for _, c := range cases {
+		d, _, err := Sniff(bytes.NewReader(c.data), DefaultSniffLen)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if d.Name != c.charset || d.BOMLen != c.bomLen || d.Confidence < c.minConfidence {
+			t.Errorf("For %s, expected %s, BOM %d, confidence >= %.2f, but got %s, BOM %d, confidence %.2f",
+				c.name, c.charset, c.bomLen, c.minConfidence, d.Name, d.BOMLen, d.Confidence)
+		}
+		if d.IsBinary != (c.charset == "") {
+			t.Errorf("For %s, expected binary to be %v", c.name, c.charset == "")
+		}
+	}
+}
+
+func TestNewReaderDetection(t *testing.T) {
+	le, err := ioutil.ReadFile("testfiles/utf16-le.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"utf-16le", le[2:], "28/10/2016 11:54:00 : Log file opened! (BWIFaceBasic v. 1.0.202)\r\n"},
+		{"windows-1252", []byte("\x93Caf\xe9\x94\n"), "“Café”\n"},
+		{"iso-8859-1", []byte("Cr\xe8me br\xfbl\xe9e\n"), "Crème brûlée\n"},
+		{"binary", []byte("\x7fELF\x02\x01\x00\x00\xe9\n"), "\x7fELF\x02\x01\x00\x00\xe9\n"},
+	}
+	for _, c := range cases {
+		got, _ := bufio.NewReader(NewReader(bytes.NewReader(c.data))).ReadString('\n')
+		if got != c.expected {
+			t.Errorf("For %s, expected %q, but got %q", c.name, c.expected, got)
+		}
+	}
+	got, _ := ioutil.ReadAll(NewReader(strings.NewReader("d\xe9j\xe0")))
+	if string(got) != "déjà" {
+		t.Errorf("Expected 'déjà', but got '%s'", got)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	data := []byte("\xef\xbb\xbfd\xc3\xa9j\xc3\xa0")
+	res, r, err := Detect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if res.Name != "UTF-8" || res.BOMLen != 3 || res.Confidence != 1 || res.IsBinary {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	replay, _ := ioutil.ReadAll(r)
+	if !bytes.Equal(replay, data) {
+		t.Errorf("Expected peeked bytes to be replayed, but got %q", replay)
+	}
+	got, _ := ioutil.ReadAll(res.Decode(bytes.NewReader(data)))
+	if string(got) != "déjà" {
+		t.Errorf("Expected 'déjà', but got %q", got)
+	}
+
+	res, r, err = Detect(bytes.NewReader([]byte("\xfe\xff\x00d\x00\xe9")))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	got, _ = ioutil.ReadAll(res.Decode(r))
+	if res.Name != "UTF-16BE" || string(got) != "dé" {
+		t.Errorf("Expected UTF-16BE 'dé', but got %s %q", res.Name, got)
+	}
+}
+
+func TestNewReaderTestfiles(t *testing.T) {
+	expected, err := ioutil.ReadFile("testfiles/utf8.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = expected[3:]
+	files := []struct {
+		name   string
+		bomLen int
+	}{
+		{"utf8.txt", 3},
+		{"utf16-le.txt", 2},
+		{"utf16-be.txt", 2},
+		{"utf32-le.txt", 4},
+		{"utf32-be.txt", 4},
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile("testfiles/" + f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, bom := range []bool{true, false} {
+			if !bom {
+				data = data[f.bomLen:]
+			}
+			got, err := ioutil.ReadAll(NewReader(bytes.NewReader(data)))
+			if err != nil {
+				t.Errorf("Unexpected error %s", err)
+			}
+			if !bytes.Equal(got, expected) {
+				t.Errorf("Expected content of '%s' (BOM %v) to be decoded", f.name, bom)
+			}
+		}
+	}
+}
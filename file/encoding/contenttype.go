@@ -0,0 +1,127 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"net/http"
+	"strings"
+)
+
+// contentSig recognizes a content type that net/http doesn't sniff
+type contentSig struct {
+	offset int
+	sig    string
+	ct     string
+}
+
+// contentSignatures are checked before net/http sniffing rules
+var contentSignatures = []contentSig{
+	{0, "\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1", "application/x-ole-storage"}, // Legacy office documents
+	{0, "7z\xBC\xAF\x27\x1C", "application/x-7z-compressed"},
+	{0, "\xFD7zXZ\x00", "application/x-xz"},
+	{0, "070701", "application/x-cpio"},
+	{0, "070702", "application/x-cpio"},
+	{257, "ustar", "application/x-tar"},
+	{0, "\x7FELF", "application/x-executable"},
+}
+
+// zipContentTypes gives the content type of zip based documents by
+// their first member names
+var zipContentTypes = []struct {
+	member string
+	ct     string
+}{
+	{"word/", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	{"xl/", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{"ppt/", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+	{"META-INF/MANIFEST.MF", "application/java-archive"},
+}
+
+// SniffContentType gives the MIME type of data, the beginning of a content,
+// or the whole content when it isn't truncated.
+// Besides the types known by net/http, it recognizes office documents,
+// archives and executables. Text types are given with the charset found by
+// Detect. It returns "application/octet-stream" for unknown binary content.
+func SniffContentType(data []byte, truncated bool) string {
+	for _, s := range contentSignatures {
+		if len(data) >= s.offset+len(s.sig) && string(data[s.offset:s.offset+len(s.sig)]) == s.sig {
+			return s.ct
+		}
+	}
+	// bzip2 header gives the block size, from 1 to 9
+	if len(data) >= 4 && string(data[:3]) == "BZh" && '1' <= data[3] && data[3] <= '9' {
+		return "application/x-bzip2"
+	}
+	ct := http.DetectContentType(data)
+	switch {
+	case ct == "application/zip":
+		return sniffZip(data)
+	case ct == "application/octet-stream" || strings.HasPrefix(ct, "text/"):
+		res := sniff(data, truncated)
+		if res.IsBinary {
+			return "application/octet-stream"
+		}
+		if ct == "application/octet-stream" {
+			ct = "text/plain"
+		}
+		if i := strings.IndexByte(ct, ';'); i >= 0 {
+			ct = ct[:i]
+		}
+		return ct + "; charset=" + strings.ToLower(res.Name)
+	}
+	return ct
+}
+
+// sniffZip recognizes documents that are zip archives by the names of
+// their first members, read from the local headers found in data
+func sniffZip(data []byte) string {
+	for i, m := range zipMembers(data) {
+		// ODF and EPUB start with a stored member named mimetype whose
+		// content is the content type
+		if i == 0 && m.name == "mimetype" && m.stored && 0 < len(m.content) && len(m.content) < 80 {
+			return string(m.content)
+		}
+		for _, z := range zipContentTypes {
+			if strings.HasPrefix(m.name, z.member) {
+				return z.ct
+			}
+		}
+	}
+	return "application/zip"
+}
+
+// zipMember is a member read from its local header
+type zipMember struct {
+	name    string
+	stored  bool
+	content []byte // content as stored, nil when beyond data
+}
+
+// zipMembers reads the local headers of data, the beginning of a zip
+// archive. It stops at the end of data, or at a member whose size is
+// given after its content.
+func zipMembers(data []byte) []zipMember {
+	members := []zipMember{}
+	for len(data) >= 30 && string(data[:4]) == "PK\x03\x04" {
+		flags := binary.LittleEndian.Uint16(data[6:8])
+		size := int(binary.LittleEndian.Uint32(data[18:22]))
+		nameLen := int(binary.LittleEndian.Uint16(data[26:28]))
+		extraLen := int(binary.LittleEndian.Uint16(data[28:30]))
+		if len(data) < 30+nameLen {
+			break
+		}
+		m := zipMember{
+			name:   string(data[30 : 30+nameLen]),
+			stored: binary.LittleEndian.Uint16(data[8:10]) == 0,
+		}
+		start := 30 + nameLen + extraLen
+		if start+size <= len(data) {
+			m.content = data[start : start+size]
+		}
+		members = append(members, m)
+		if flags&0x08 != 0 || start+size > len(data) {
+			break
+		}
+		data = data[start+size:]
+	}
+	return members
+}
@@ -0,0 +1,83 @@
+package encoding
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"hash/crc32"
+	"testing"
+)
+
+// zipDocument gives a zip archive whose first member is stored
+func zipDocument(t *testing.T, members ...string) []byte {
+	buf := new(bytes.Buffer)
+	z := zip.NewWriter(buf)
+	for i := 0; i < len(members); i += 2 {
+		content := []byte(members[i+1])
+		w, err := z.CreateRaw(&zip.FileHeader{
+			Name:               members[i],
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE(content),
+			CompressedSize64:   uint64(len(content)),
+			UncompressedSize64: uint64(len(content)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniffContentType(t *testing.T) {
+	tarball := new(bytes.Buffer)
+	tw := tar.NewWriter(tarball)
+	tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0644, Size: 2})
+	tw.Write([]byte("a\n"))
+	tw.Close()
+
+	cases := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+		{"pdf", []byte("%PDF-1.4\n"), "application/pdf"},
+		{"gzip", []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00"), "application/x-gzip"},
+		{"zip", zipDocument(t, "a.txt", "a\n"), "application/zip"},
+		{"docx", zipDocument(t, "[Content_Types].xml", "<Types/>", "word/document.xml", "<document/>"), "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"xlsx", zipDocument(t, "[Content_Types].xml", "<Types/>", "xl/workbook.xml", "<workbook/>"), "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{"zip naming word/", zipDocument(t, "notes.txt", "see word/document.xml", "xl.txt", "xl/"), "application/zip"},
+		{"jar", zipDocument(t, "META-INF/", "", "META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n"), "application/java-archive"},
+		{"odt", zipDocument(t, "mimetype", "application/vnd.oasis.opendocument.text", "content.xml", "<x/>"), "application/vnd.oasis.opendocument.text"},
+		{"epub", zipDocument(t, "mimetype", "application/epub+zip"), "application/epub+zip"},
+		{"doc", []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1\x00\x00"), "application/x-ole-storage"},
+		{"7z", []byte("7z\xBC\xAF\x27\x1C\x00\x04"), "application/x-7z-compressed"},
+		{"bzip2", []byte("BZh91AY&SY"), "application/x-bzip2"},
+		{"tar", tarball.Bytes(), "application/x-tar"},
+		{"elf", []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00"), "application/x-executable"},
+		{"html", []byte("<!DOCTYPE html><html></html>"), "text/html; charset=utf-8"},
+		{"text", []byte("Hello world\n"), "text/plain; charset=utf-8"},
+		{"windows-1252 text", []byte("\x93Caf\xe9\x94\n"), "text/plain; charset=windows-1252"},
+		{"utf-16le text", []byte("H\x00e\x00l\x00l\x00o\x00\n\x00"), "text/plain; charset=utf-16le"},
+		{"utf-16be text with BOM", []byte("\xfe\xff\x00H\x00i"), "text/plain; charset=utf-16be"},
+		{"binary", []byte("\x00\x01\x02\x03\xff\xfe\xfd\x04"), "application/octet-stream"},
+	}
+	for _, c := range cases {
+		if got := SniffContentType(c.data, true); got != c.expected {
+			t.Errorf("For %s, expected '%s', but got '%s'", c.name, c.expected, got)
+		}
+	}
+
+	// A sequence cut at the end is UTF-8 only when the content goes on
+	cut := []byte("Caf\xc3")
+	if got, expected := SniffContentType(cut, true), "text/plain; charset=utf-8"; got != expected {
+		t.Errorf("For truncated content, expected '%s', but got '%s'", expected, got)
+	}
+	if got := SniffContentType(cut, false); got == "text/plain; charset=utf-8" {
+		t.Errorf("For whole content, expected another charset than UTF-8")
+	}
+}
@@ -0,0 +1,184 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+// InvalidPolicy tells NewReader what to do with invalid sequences of Unicode content
+type InvalidPolicy int
+
+// Policies for invalid sequences
+const (
+	ReplaceInvalid InvalidPolicy = iota // Replace the sequence with U+FFFD
+	SkipInvalid                         // Drop the sequence
+	FailOnInvalid                       // Stop reading with an *InvalidError
+	Latin1Invalid                       // Decode bytes of invalid UTF-8 sequences as ISO-8859-1, replace others
+)
+
+// InvalidError is returned by readers failing on invalid sequences
+type InvalidError struct {
+	Charset string // Charset of the content
+	Offset  int64  // Position of the invalid sequence in the content, BOM included
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("Invalid %s sequence at offset %d", e.Charset, e.Offset)
+}
+
+// OnInvalid set the policy applied to invalid sequences of Unicode content.
+// Without this option, invalid sequences are replaced with U+FFFD, including
+// the few ones tolerated by the detection of UTF-8.
+func OnInvalid(p InvalidPolicy) Option {
+	return func(o *options) {
+		o.validate = true
+		o.invalidPolicy = p
+	}
+}
+
+// CountInvalid makes NewReader counting invalid sequences of Unicode content
+// into count. It is complete once the reader has reached the end of the content.
+// Invalid sequences are replaced unless OnInvalid is given.
+func CountInvalid(count *int) Option {
+	return func(o *options) {
+		o.validate = true
+		o.invalidCount = count
+	}
+}
+
+// validator applies the invalid policy on Unicode content, before its decoding
+type validator struct {
+	charset string
+	unit    int              // code unit size, 1 for UTF-8
+	order   binary.ByteOrder // byte order of UTF-16 and UTF-32
+	policy  InvalidPolicy
+	count   *int
+	offset  int64 // offset of src in the content
+}
+
+// newValidator gives the validator of the detected charset, nil when the
+// charset can't have invalid sequences
+func newValidator(res Result, o options) *validator {
+	v := &validator{charset: res.Name, policy: o.invalidPolicy, count: o.invalidCount}
+	switch res.Name {
+	case "UTF-8":
+		v.unit = 1
+	case "UTF-16BE":
+		v.unit, v.order = 2, binary.BigEndian
+	case "UTF-16LE":
+		v.unit, v.order = 2, binary.LittleEndian
+	case "UTF-32BE":
+		v.unit, v.order = 4, binary.BigEndian
+	case "UTF-32LE":
+		v.unit, v.order = 4, binary.LittleEndian
+	default:
+		return nil
+	}
+	return v
+}
+
+// Reset implements transform.Transformer
+func (v *validator) Reset() {
+	v.offset = 0
+	if v.count != nil {
+		*v.count = 0
+	}
+}
+
+// Transform implements transform.Transformer
+func (v *validator) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	defer func() { v.offset += int64(nSrc) }()
+	for nSrc < len(src) {
+		size, valid := v.next(src[nSrc:], atEOF)
+		if size == 0 {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		out := src[nSrc : nSrc+size]
+		if !valid {
+			switch v.policy {
+			case FailOnInvalid:
+				if v.count != nil {
+					*v.count++
+				}
+				return nDst, nSrc, &InvalidError{Charset: v.charset, Offset: v.offset + int64(nSrc)}
+			case SkipInvalid:
+				out = nil
+			case Latin1Invalid:
+				if v.unit == 1 {
+					out = []byte(string(rune(src[nSrc])))
+					break
+				}
+				out = v.replacement()
+			default:
+				out = v.replacement()
+			}
+		}
+		if nDst+len(out) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], out)
+		nSrc += size
+		if !valid && v.count != nil {
+			*v.count++
+		}
+	}
+	return nDst, nSrc, nil
+}
+
+// next gives the size of the sequence that starts src, and its validity.
+// The size is 0 when more bytes are needed.
+func (v *validator) next(src []byte, atEOF bool) (int, bool) {
+	if len(src) < v.unit {
+		if !atEOF {
+			return 0, false
+		}
+		return len(src), false // truncated code unit
+	}
+	switch v.unit {
+	case 1:
+		if src[0] < utf8.RuneSelf {
+			return 1, true
+		}
+		if !utf8.FullRune(src) && !atEOF {
+			return 0, false
+		}
+		r, size := utf8.DecodeRune(src)
+		return size, r != utf8.RuneError || size > 1
+	case 2:
+		u := v.order.Uint16(src)
+		switch {
+		case u < 0xD800 || u > 0xDFFF:
+			return 2, true
+		case u >= 0xDC00:
+			return 2, false // low surrogate without high surrogate
+		case len(src) < 4 && !atEOF:
+			return 0, false
+		case len(src) >= 4:
+			low := v.order.Uint16(src[2:])
+			if low >= 0xDC00 && low <= 0xDFFF {
+				return 4, true
+			}
+		}
+		return 2, false // high surrogate without low surrogate
+	default:
+		u := v.order.Uint32(src)
+		return 4, u <= 0x10FFFF && (u < 0xD800 || u > 0xDFFF)
+	}
+}
+
+// replacement gives U+FFFD in the charset
+func (v *validator) replacement() []byte {
+	b := make([]byte, v.unit)
+	switch v.unit {
+	case 1:
+		return []byte(string(utf8.RuneError))
+	case 2:
+		v.order.PutUint16(b, utf8.RuneError)
+	default:
+		v.order.PutUint32(b, utf8.RuneError)
+	}
+	return b
+}
@@ -0,0 +1,66 @@
+package encoding
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestOnInvalid(t *testing.T) {
+	// Valid UTF-8 with an invalid byte, and an UTF-16LE text with unpaired surrogates
+	utf8Text := []byte("d\xc3\xa9j\xe0 vu, \xc3\xa0 l'\xc3\xa9t\xc3\xa9")
+	utf16Text := []byte("\xff\xfeo\x00\x00\xd8k\x00\x00\xdc")
+	cases := []struct {
+		name     string
+		data     []byte
+		policy   InvalidPolicy
+		expected string
+		count    int
+	}{
+		{"utf-8 replace", utf8Text, ReplaceInvalid, "déj� vu, à l'été", 1},
+		{"utf-8 skip", utf8Text, SkipInvalid, "déj vu, à l'été", 1},
+		{"utf-8 latin-1", utf8Text, Latin1Invalid, "déjà vu, à l'été", 1},
+		{"utf-16 replace", utf16Text, ReplaceInvalid, "o�k�", 2},
+		{"utf-16 skip", utf16Text, SkipInvalid, "ok", 2},
+		{"utf-16 latin-1", utf16Text, Latin1Invalid, "o�k�", 2},
+		{"utf-32 skip", []byte("\xff\xfe\x00\x00o\x00\x00\x00\x00\x00\x11\x00k\x00\x00\x00"), SkipInvalid, "ok", 1},
+	}
+	got, _ := ioutil.ReadAll(NewReader(bytes.NewReader(utf8Text)))
+	if string(got) != "déj\uFFFD vu, à l'été" {
+		t.Errorf("Expected invalid UTF-8 to be replaced by default, but got %q", got)
+	}
+	for _, c := range cases {
+		count := -1
+		got, err := ioutil.ReadAll(NewReader(bytes.NewReader(c.data), OnInvalid(c.policy), CountInvalid(&count)))
+		if err != nil {
+			t.Errorf("For %s, unexpected error %s", c.name, err)
+		}
+		if string(got) != c.expected || count != c.count {
+			t.Errorf("For %s, expected %q with %d invalid sequences, but got %q with %d", c.name, c.expected, c.count, got, count)
+		}
+	}
+}
+
+func TestFailOnInvalid(t *testing.T) {
+	data := strings.Repeat("é", 3000) + "\xff"
+	_, err := ioutil.ReadAll(NewReader(strings.NewReader(data), OnInvalid(FailOnInvalid)))
+	var invalid *InvalidError
+	if !errors.As(err, &invalid) || invalid.Offset != 6000 || invalid.Charset != "UTF-8" {
+		t.Errorf("Expected invalid UTF-8 at offset 6000, but got %v", err)
+	}
+
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader([]byte("\xfe\xff\x00o\xdc\x00")), OnInvalid(FailOnInvalid)))
+	if !errors.As(err, &invalid) || invalid.Offset != 4 || invalid.Charset != "UTF-16BE" {
+		t.Errorf("Expected invalid UTF-16BE at offset 4, but got %v", err)
+	}
+}
+
+func TestCountInvalid(t *testing.T) {
+	count := -1
+	got, _ := ioutil.ReadAll(NewReader(strings.NewReader("\xe9t\xe9"), CountInvalid(&count)))
+	if count != 0 || string(got) != "été" {
+		t.Errorf("Expected ISO-8859-1 content without invalid sequence, but got %q with %d", got, count)
+	}
+}
@@ -1,26 +1,55 @@
 package encoding
 
 import (
-	"fmt"
-	"os"
+	"log/slog"
+	"sync/atomic"
 )
 
-// Package level logger initialized with the s
-var logger = Logger(log{})
+// WithLogger set the logger receiving events of NewReader, like the detected
+// charset. By default, events go to slog default logger, tagged with
+// component=encoding.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
 
 // Logger is an interface for a logger
+//
+// Deprecated: give a *slog.Logger to NewReader with WithLogger.
 type Logger interface {
 	Printf(string, ...interface{})
 }
 
-// Simple logger
-type log struct{}
+// legacy is the logger given to SetLogger
+var legacy atomic.Pointer[Logger]
 
-func (l log) Printf(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, format, args...)
+// SetLogger set the logger for the package. It receives the warnings of
+// NewReader that isn't given a logger, nil restores the default logger.
+//
+// Deprecated: give a *slog.Logger to NewReader with WithLogger.
+func SetLogger(l Logger) {
+	if l == nil {
+		legacy.Store(nil)
+		return
+	}
+	legacy.Store(&l)
 }
 
-// SetLogger set the logger for the package
-func SetLogger(l Logger) {
-	logger = l
+// printfWriter writes log lines to a Logger
+type printfWriter struct {
+	l Logger
+}
+
+func (w printfWriter) Write(p []byte) (int, error) {
+	w.l.Printf("%s", p)
+	return len(p), nil
+}
+
+// defaultLogger is used when no logger is given
+func defaultLogger() *slog.Logger {
+	if l := legacy.Load(); l != nil {
+		return slog.New(slog.NewTextHandler(printfWriter{*l}, nil)).With("component", "encoding")
+	}
+	return slog.Default().With("component", "encoding")
 }
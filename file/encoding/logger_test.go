@@ -0,0 +1,46 @@
+package encoding
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestWithLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ioutil.ReadAll(NewReader(bytes.NewReader([]byte("\xff\xfeH\x00i\x00")), WithLogger(l.With("file", "a.txt"))))
+	if got := buf.String(); !strings.Contains(got, "file=a.txt") || !strings.Contains(got, "encoding=UTF-16LE") {
+		t.Errorf("Expected detected charset to be logged, but got %q", got)
+	}
+
+	buf.Reset()
+	NewReader(iotest.ErrReader(errors.New("boom")), WithLogger(l))
+	if got := buf.String(); !strings.Contains(got, "level=WARN") || !strings.Contains(got, "boom") {
+		t.Errorf("Expected read error to be logged, but got %q", got)
+	}
+}
+
+// printfLogger records lines given to Printf
+type printfLogger struct {
+	lines []string
+}
+
+func (l *printfLogger) Printf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestSetLogger(t *testing.T) {
+	l := &printfLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+	NewReader(iotest.ErrReader(errors.New("boom")))
+	if len(l.lines) != 1 || !strings.Contains(l.lines[0], "boom") || !strings.Contains(l.lines[0], "component=encoding") {
+		t.Errorf("Expected read error to be given to the legacy logger, but got %q", l.lines)
+	}
+}
@@ -0,0 +1,157 @@
+package encoding
+
+import (
+	"golang.org/x/text/transform"
+)
+
+// Newline is the line ending style of a text
+type Newline int
+
+// Line ending styles
+const (
+	NoNewline     Newline = iota // The text has no line ending
+	LF                           // Unix style
+	CRLF                         // Windows style
+	CR                           // Old Mac style
+	MixedNewlines                // The text mixes several styles
+)
+
+func (n Newline) String() string {
+	switch n {
+	case NoNewline:
+		return "none"
+	case LF:
+		return "LF"
+	case CRLF:
+		return "CRLF"
+	case CR:
+		return "CR"
+	case MixedNewlines:
+		return "mixed"
+	}
+	return "unknown"
+}
+
+// NormalizeNewlines makes NewReader converting line endings into LF. The
+// style of the original text is stored into detected, when not nil. It is
+// complete once the reader has reached the end of the text.
+func NormalizeNewlines(detected *Newline) Option {
+	return func(o *options) {
+		o.newlines = true
+		o.newlineStyle = detected
+	}
+}
+
+// TrimNULs makes NewReader removing NUL bytes that pad the end of the text
+func TrimNULs() Option {
+	return func(o *options) {
+		o.trimNULs = true
+	}
+}
+
+// StripControls makes NewReader removing control characters, except
+// tabulations, line endings and form feeds
+func StripControls() Option {
+	return func(o *options) {
+		o.stripControls = true
+	}
+}
+
+// lineTransformer cleans up UTF-8 text according to options
+type lineTransformer struct {
+	newlines      bool
+	trimNULs      bool
+	stripControls bool
+	style         *Newline
+
+	nuls int    // NULs held until something else than NULs follows
+	seen [4]int // line endings seen, indexed by style
+}
+
+func newLineTransformer(o options) *lineTransformer {
+	return &lineTransformer{
+		newlines:      o.newlines,
+		trimNULs:      o.trimNULs,
+		stripControls: o.stripControls,
+		style:         o.newlineStyle,
+	}
+}
+
+// Reset implements transform.Transformer
+func (t *lineTransformer) Reset() {
+	t.nuls = 0
+	t.seen = [4]int{}
+}
+
+// Transform implements transform.Transformer
+func (t *lineTransformer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	defer t.report()
+	for nSrc < len(src) {
+		b := src[nSrc]
+		if b == 0 && t.trimNULs && !t.stripControls {
+			t.nuls++
+			nSrc++
+			continue
+		}
+		// Held NULs aren't trailing ones
+		for ; t.nuls > 0; t.nuls-- {
+			if nDst >= len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = 0
+			nDst++
+		}
+		size, ending := 1, NoNewline
+		switch {
+		case b == '\r' && t.newlines:
+			if nSrc+1 >= len(src) && !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			ending = CR
+			if nSrc+1 < len(src) && src[nSrc+1] == '\n' {
+				ending, size = CRLF, 2
+			}
+			b = '\n'
+		case b == '\n':
+			ending = LF
+		case t.stripControls && isControl(b):
+			nSrc++
+			continue
+		}
+		if nDst >= len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		dst[nDst] = b
+		nDst++
+		nSrc += size
+		t.seen[ending]++
+	}
+	return nDst, nSrc, nil
+}
+
+// report stores the style of line endings seen so far
+func (t *lineTransformer) report() {
+	if t.style == nil {
+		return
+	}
+	*t.style = NoNewline
+	for n, count := range t.seen {
+		if n == int(NoNewline) || count == 0 {
+			continue
+		}
+		if *t.style != NoNewline {
+			*t.style = MixedNewlines
+			return
+		}
+		*t.style = Newline(n)
+	}
+}
+
+// isControl tells if b is a control character other than tabulation, line endings and form feed
+func isControl(b byte) bool {
+	switch b {
+	case '\t', '\n', '\r', '\f':
+		return false
+	}
+	return b < 0x20 || b == 0x7F
+}
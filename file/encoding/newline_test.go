@@ -0,0 +1,81 @@
+package encoding
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeNewlines(t *testing.T) {
+	cases := []struct {
+		data     string
+		expected string
+		style    Newline
+	}{
+		{"a\nb\n", "a\nb\n", LF},
+		{"a\r\nb\r\n", "a\nb\n", CRLF},
+		{"a\rb\r", "a\nb\n", CR},
+		{"a\r\nb\rc\n", "a\nb\nc\n", MixedNewlines},
+		{"a\r\r\nb", "a\n\nb", MixedNewlines},
+		{"ab", "ab", NoNewline},
+	}
+	for _, c := range cases {
+		var style Newline
+		got, err := ioutil.ReadAll(NewReader(bytes.NewReader([]byte(c.data)), NormalizeNewlines(&style)))
+		if err != nil {
+			t.Errorf("Unexpected error %s", err)
+		}
+		if string(got) != c.expected || style != c.style {
+			t.Errorf("For %q, expected %q with %s line endings, but got %q with %s", c.data, c.expected, c.style, got, style)
+		}
+	}
+}
+
+func TestNormalizeNewlinesLarge(t *testing.T) {
+	// CRLF split across transformer buffers
+	data := bytes.Repeat([]byte("abc\r\n"), 10000)
+	var style Newline
+	got, err := ioutil.ReadAll(NewReader(bytes.NewReader(data), NormalizeNewlines(&style)))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if !bytes.Equal(got, bytes.Repeat([]byte("abc\n"), 10000)) || style != CRLF {
+		t.Errorf("Expected CRLF line endings to be converted, but got %s", style)
+	}
+
+	le, err := ioutil.ReadFile("testfiles/utf16-le.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = ioutil.ReadAll(NewReader(bytes.NewReader(le), NormalizeNewlines(&style)))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if bytes.IndexByte(got, '\r') >= 0 || style != CRLF {
+		t.Errorf("Expected CRLF line endings of utf16-le.txt to be converted, but got %s", style)
+	}
+}
+
+func TestTrimNULsAndControls(t *testing.T) {
+	text := strings.Repeat("text ", 20)
+	padded := append([]byte(text+"ab\x01\x1bc\n"), make([]byte, 10000)...)
+	cases := []struct {
+		name     string
+		opts     []Option
+		expected string
+	}{
+		{"trim NULs", []Option{TrimNULs()}, text + "ab\x01\x1bc\n"},
+		{"strip controls", []Option{StripControls()}, text + "abc\n"},
+		{"both", []Option{TrimNULs(), StripControls()}, text + "abc\n"},
+	}
+	for _, c := range cases {
+		got, err := ioutil.ReadAll(NewReader(bytes.NewReader(padded), c.opts...))
+		if err != nil {
+			t.Errorf("Unexpected error %s", err)
+		}
+		if string(got) != c.expected {
+			t.Errorf("For %s, expected %q, but got %q", c.name, c.expected, got)
+		}
+	}
+}
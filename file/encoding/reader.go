@@ -1,36 +1,89 @@
 package encoding
 
 import (
-	"bufio"
 	"io"
+	"log/slog"
 
-	"github.com/pkg/errors"
-	"golang.org/x/text/encoding/unicode"
+	textencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/ianaindex"
 	"golang.org/x/text/transform"
 )
 
-// NewReader takes a reader of utf-16, utf-8 and return a reader utf-8 ready for golang work
-func NewReader(r io.Reader) io.Reader {
-	var err error
-	var buf []byte
-	o := bufio.NewReader(r)
-
-	// Get few bytes to test the type of the input file
-	buf, err = o.Peek(5)
-	if err != nil && err != io.EOF {
-		logger.Printf("%s\n", errors.Wrap(err, "can't read buffer in reader.NewReader"))
-		return o
-	}
-
-	switch detectUTFEncoding(buf) {
-	case "utf-16be":
-		return transform.NewReader(o, unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder())
-	case "utf-16le":
-		return transform.NewReader(o, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder())
-	case "utf-8-BOM":
-		// Discard BOM
-		o.Discard(3)
-		return o
-	}
-	return o
+// Option is a functional option for NewReader
+type Option func(*options)
+
+type options struct {
+	fallback textencoding.Encoding // encoding of files without BOM
+	detected *Result               // receives the detected charset
+
+	newlines      bool     // convert line endings into LF
+	newlineStyle  *Newline // receives the original line endings style
+	trimNULs      bool     // remove NULs padding the end of the text
+	stripControls bool     // remove control characters
+
+	validate      bool          // check Unicode content
+	invalidPolicy InvalidPolicy // what to do with invalid sequences
+	invalidCount  *int          // receives the number of invalid sequences
+
+	logger *slog.Logger
+}
+
+// Fallback set the encoding of files without BOM that aren't recognized as
+// Unicode, instead of the guessed single byte code page.
+func Fallback(e textencoding.Encoding) Option {
+	return func(o *options) {
+		o.fallback = e
+	}
+}
+
+// Detected makes NewReader storing the detected charset into res. It can be
+// given to Preserve to write the content back in the same charset.
+func Detected(res *Result) Option {
+	return func(o *options) {
+		o.detected = res
+	}
+}
+
+// NewReader takes a reader of text and return a reader utf-8 ready for golang work.
+// The charset is detected from the first bytes: BOMs, UTF-32 and UTF-16 without BOM,
+// UTF-8, Windows-1252 and ISO-8859-1 are recognized. Content that isn't text
+// is given as is.
+func NewReader(r io.Reader, opts ...Option) io.Reader {
+	options := options{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.logger == nil {
+		options.logger = defaultLogger()
+	}
+
+	res, r, err := Detect(r)
+	if err != nil {
+		options.logger.Warn("Can't detect charset", "stage", "detect", "error", err)
+		return r
+	}
+	if _, guessed := res.Encoding.(*charmap.Charmap); guessed && options.fallback != nil {
+		name, _ := ianaindex.IANA.Name(options.fallback)
+		res = Result{Name: name, Encoding: options.fallback, Confidence: res.Confidence}
+	}
+	options.logger.Debug("Charset detected", "stage", "detect", "encoding", res.Name,
+		"confidence", res.Confidence, "bom", res.BOMLen > 0, "binary", res.IsBinary)
+	if options.detected != nil {
+		*options.detected = res
+	}
+	if options.invalidCount != nil {
+		*options.invalidCount = 0
+	}
+	// UTF-8 decoding keeps invalid bytes: they are always checked
+	if options.validate || res.Name == utf8Result.Name {
+		if v := newValidator(res, options); v != nil {
+			r = transform.NewReader(r, v)
+		}
+	}
+	if res.IsBinary || !(options.newlines || options.trimNULs || options.stripControls) {
+		return res.Decode(r)
+	}
+	return transform.NewReader(res.Decode(r), newLineTransformer(options))
 }
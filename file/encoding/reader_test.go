@@ -4,6 +4,9 @@ import "testing"
 import "bytes"
 import "bufio"
 import "fmt"
+import "io/ioutil"
+
+import "golang.org/x/text/encoding/charmap"
 
 func TestNewReader(t *testing.T) {
 	for _, c := range utf16ReaderTestCases {
@@ -62,3 +65,16 @@ var utf16ReaderTestCases = []struct {
 		"28/10/2016 11:54:00 : Log file opened! (BWIFaceBasic v. 1.0.202)\r",
 	},
 }
+
+func TestNewReaderFallback(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte("caf\xe9")), Fallback(charmap.Windows1252))
+	got, _ := ioutil.ReadAll(r)
+	if string(got) != "café" {
+		t.Errorf("Expected 'café', but got '%s'", got)
+	}
+	r = NewReader(bytes.NewReader([]byte("\xef\xbb\xbfcafé")), Fallback(charmap.Windows1252))
+	got, _ = ioutil.ReadAll(r)
+	if string(got) != "café" {
+		t.Errorf("Expected BOM to prevail over fallback, but got '%s'", got)
+	}
+}
@@ -1,97 +1,32 @@
 package encoding
 
-/*
- This package provides text file parsing capabilities, stolen form html package
-*/
-
-// The algorithm uses at most sniffLen bytes to make its decision.
-const sniffLen = 32
-
-// DetectUTFEncoding determine the type of stream by checking BOM
-func detectUTFEncoding(data []byte) string {
-	if len(data) > sniffLen {
-		data = data[:sniffLen]
-	}
-
-	// Index of the first non-whitespace byte in data.
-	firstNonWS := 0
-	for ; firstNonWS < len(data) && isWS(data[firstNonWS]); firstNonWS++ {
-	}
-
-	for _, sig := range sniffSignatures {
-		if ct := sig.match(data, firstNonWS); ct != "" {
-			return ct
-		}
-	}
-
-	return "oops" // fallback
-}
-
-// Consume whitespaces
-func isWS(b byte) bool {
-	switch b {
-	case '\t', '\n', '\x0c', '\r', ' ':
-		return true
-	}
-	return false
+import (
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+// bomSignatures are the byte order marks, and the charset they reveal.
+// UTF-32LE BOM starts like UTF-16LE one, it must be checked first.
+var bomSignatures = []struct {
+	bom    string
+	result Result
+}{
+	{"\x00\x00\xFE\xFF", Result{Name: "UTF-32BE", Encoding: utf32.UTF32(utf32.BigEndian, utf32.ExpectBOM)}},
+	{"\xFF\xFE\x00\x00", Result{Name: "UTF-32LE", Encoding: utf32.UTF32(utf32.LittleEndian, utf32.ExpectBOM)}},
+	{"\xFE\xFF", Result{Name: "UTF-16BE", Encoding: unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)}},
+	{"\xFF\xFE", Result{Name: "UTF-16LE", Encoding: unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)}},
+	{"\xEF\xBB\xBF", Result{Name: "UTF-8", Encoding: unicode.UTF8BOM}},
 }
 
-// BOMs
-var sniffSignatures = []sniffSig{
-	// UTF BOMs.
-	&maskedSig{mask: []byte("\xFF\xFF\x00\x00"), pat: []byte("\xFE\xFF\x00\x00"), ct: "utf-16be"},
-	&maskedSig{mask: []byte("\xFF\xFF\x00\x00"), pat: []byte("\xFF\xFE\x00\x00"), ct: "utf-16le"},
-	&maskedSig{mask: []byte("\xFF\xFF\xFF\x00"), pat: []byte("\xEF\xBB\xBF\x00"), ct: "utf-8-BOM"},
-
-	textSig{}, // should be last
-
-}
-
-type sniffSig interface {
-	// match returns the MIME type of the data, or "" if unknown.
-	match(data []byte, firstNonWS int) string
-}
-
-type maskedSig struct {
-	mask, pat []byte
-	skipWS    bool
-	ct        string
-}
-
-func (m *maskedSig) match(data []byte, firstNonWS int) string {
-	// pattern matching algorithm section 6
-	// https://mimesniff.spec.whatwg.org/#pattern-matching-algorithm
-
-	if m.skipWS {
-		data = data[firstNonWS:]
-	}
-	if len(m.pat) != len(m.mask) {
-		return ""
-	}
-	if len(data) < len(m.mask) {
-		return ""
-	}
-	for i, mask := range m.mask {
-		db := data[i] & mask
-		if db != m.pat[i] {
-			return ""
-		}
-	}
-	return m.ct
-}
-
-type textSig struct{}
-
-func (textSig) match(data []byte, firstNonWS int) string {
-	// c.f. section 5, step 4.
-	for _, b := range data[firstNonWS:] {
-		switch {
-		case b <= 0x08,
-			b == 0x0B,
-			0x0E <= b && b <= 0x1A,
-			0x1C <= b && b <= 0x1F:
-			return ""
+// detectBOM determines the charset of data by checking its BOM
+func detectBOM(data []byte) (Result, bool) {
+	for _, sig := range bomSignatures {
+		if len(data) >= len(sig.bom) && string(data[:len(sig.bom)]) == sig.bom {
+			res := sig.result
+			res.BOMLen = len(sig.bom)
+			res.Confidence = 1
+			return res, true
 		}
 	}
-	return "utf-8"
+	return Result{}, false
 }
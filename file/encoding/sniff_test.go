@@ -2,12 +2,12 @@ package encoding
 
 import "testing"
 
-func TestDetectUTFEncoding(t *testing.T) {
+func TestDetectBOM(t *testing.T) {
 	for _, c := range testCases {
 		expected := c.encoding
-		got := detectUTFEncoding(c.data)
-		if got != expected {
-			t.Errorf("For '%#v', %s was expected, but got '%s'", c.data, expected, got)
+		res, _ := detectBOM(c.data)
+		if res.Name != expected {
+			t.Errorf("For '%#v', '%s' was expected, but got '%s'", c.data, expected, res.Name)
 		}
 	}
 }
@@ -17,18 +17,27 @@ var testCases = []struct {
 	encoding string
 }{
 	{
-		[]byte("\xfe\xff\x00\x32\x00\x38\x00\x2f\x00\x31\x00\x30\x00\x2f\x00\x32"), "utf-16be",
+		[]byte("\xfe\xff\x00\x32\x00\x38\x00\x2f\x00\x31\x00\x30\x00\x2f\x00\x32"), "UTF-16BE",
 	},
 	{
-		[]byte("\xff\xfe\x32\x00\x38\x00\x2f\x00\x31\x00\x30\x00\x2f\x00\x32\x00"), "utf-16le",
+		[]byte("\xff\xfe\x32\x00\x38\x00\x2f\x00\x31\x00\x30\x00\x2f\x00\x32\x00"), "UTF-16LE",
 	},
 	{
-		[]byte("\xbb\xef\x32\xbf\x2f\x38\x30\x31\x32\x2f\x31\x30\x20\x36\x31\x31"), "utf-8",
+		[]byte("\xef\xbb\xbf\x32\x38\x2f\x31\x30\x2f\x32\x30\x31\x36\x20\x31\x31"), "UTF-8",
 	},
 	{
-		[]byte("Hi there!"), "utf-8",
+		[]byte("\xbb\xef\x32\xbf\x2f\x38\x30\x31\x32\x2f\x31\x30\x20\x36\x31\x31"), "",
 	},
 	{
-		[]byte("中文Hi there!"), "utf-8",
+		[]byte("Hi there!"), "",
+	},
+	{
+		[]byte("\xff\xfe\x00\x00\x32\x00\x00\x00\x38\x00\x00\x00"), "UTF-32LE",
+	},
+	{
+		[]byte("\x00\x00\xfe\xff\x00\x00\x00\x32\x00\x00\x00\x38"), "UTF-32BE",
+	},
+	{
+		[]byte("\xfe"), "",
 	},
 }
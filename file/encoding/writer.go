@@ -0,0 +1,112 @@
+package encoding
+
+import (
+	"io"
+
+	textencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// NewWriter gives a writer converting UTF-8 into enc. The output starts with
+// a BOM when withBOM is true and enc is a Unicode encoding, whatever the BOM
+// policy of enc. The writer must be closed to flush the output.
+func NewWriter(w io.Writer, enc textencoding.Encoding, withBOM bool) io.WriteCloser {
+	if enc == nil {
+		enc = unicode.UTF8
+	}
+	// Some encoders write the BOM by themselves
+	implicit, _ := enc.NewEncoder().Bytes(nil)
+	wr := &writer{dst: w}
+	switch {
+	case withBOM && len(implicit) == 0:
+		wr.bom, _ = enc.NewEncoder().Bytes([]byte("\uFEFF"))
+	case !withBOM && len(implicit) > 0:
+		w = &skipWriter{w: w, n: len(implicit)}
+	}
+	wr.w = transform.NewWriter(w, enc.NewEncoder())
+	return wr
+}
+
+// WritesBOM tells if the encoder of enc starts its output with a BOM, like
+// the one of unicode.UTF8BOM.
+func WritesBOM(enc textencoding.Encoding) bool {
+	implicit, _ := enc.NewEncoder().Bytes(nil)
+	return len(implicit) > 0
+}
+
+// Preserve gives a writer converting UTF-8 into the charset of the detection
+// result, with a BOM when the detected content has one. Binary content is
+// written as is, and closing the writer does nothing.
+func Preserve(w io.Writer, res Result) io.WriteCloser {
+	if res.IsBinary {
+		return passWriter{w}
+	}
+	if res.Encoding == nil {
+		return NewWriter(w, unicode.UTF8, false)
+	}
+	return NewWriter(w, res.Encoding, res.BOMLen > 0)
+}
+
+// passWriter writes the content as is
+type passWriter struct {
+	io.Writer
+}
+
+func (passWriter) Close() error { return nil }
+
+// writer writes the BOM before the encoded content
+type writer struct {
+	w   io.WriteCloser // encoder
+	dst io.Writer
+	bom []byte // BOM not written yet
+}
+
+func (w *writer) writeBOM() error {
+	if len(w.bom) == 0 {
+		return nil
+	}
+	_, err := w.dst.Write(w.bom)
+	w.bom = nil
+	return err
+}
+
+// Write encodes p
+func (w *writer) Write(p []byte) (int, error) {
+	if err := w.writeBOM(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// Close flushes the encoder. The BOM is written even when the content is empty.
+func (w *writer) Close() error {
+	if err := w.writeBOM(); err != nil {
+		return err
+	}
+	return w.w.Close()
+}
+
+// skipWriter drops the first n bytes written
+type skipWriter struct {
+	w io.Writer
+	n int
+}
+
+func (s *skipWriter) Write(p []byte) (int, error) {
+	l := len(p)
+	if s.n > 0 {
+		skip := s.n
+		if skip > len(p) {
+			skip = len(p)
+		}
+		p, s.n = p[skip:], s.n-skip
+	}
+	if len(p) == 0 {
+		return l, nil
+	}
+	if _, err := s.w.Write(p); err != nil {
+		return 0, err
+	}
+	return l, nil
+}
@@ -0,0 +1,104 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	textencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestNewWriter(t *testing.T) {
+	cases := []struct {
+		name     string
+		enc      textencoding.Encoding
+		withBOM  bool
+		expected string
+	}{
+		{"utf-8", unicode.UTF8, false, "d\xc3\xa9"},
+		{"utf-8 with BOM", unicode.UTF8, true, "\xef\xbb\xbfd\xc3\xa9"},
+		{"utf-8 BOM policy removed", unicode.UTF8BOM, false, "d\xc3\xa9"},
+		{"utf-16le with BOM", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), true, "\xff\xfed\x00\xe9\x00"},
+		{"utf-16le BOM policy kept", unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), true, "\xff\xfed\x00\xe9\x00"},
+		{"utf-16be BOM policy removed", unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), false, "\x00d\x00\xe9"},
+		{"windows-1252 can't have BOM", charmap.Windows1252, true, "d\xe9"},
+	}
+	for _, c := range cases {
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf, c.enc, c.withBOM)
+		if _, err := io.WriteString(w, "dé"); err != nil {
+			t.Errorf("For %s, unexpected error %s", c.name, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Errorf("For %s, unexpected error %s", c.name, err)
+		}
+		if buf.String() != c.expected {
+			t.Errorf("For %s, expected %q, but got %q", c.name, c.expected, buf.String())
+		}
+	}
+}
+
+func TestPreserve(t *testing.T) {
+	files := []struct {
+		name   string
+		bomLen int
+	}{
+		{"utf8.txt", 3},
+		{"utf16-le.txt", 2},
+		{"utf16-be.txt", 2},
+		{"utf32-le.txt", 4},
+		{"utf32-be.txt", 4},
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile("testfiles/" + f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, original := range [][]byte{data, data[f.bomLen:]} {
+			var res Result
+			text, err := ioutil.ReadAll(NewReader(bytes.NewReader(original), Detected(&res)))
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			buf := new(bytes.Buffer)
+			w := Preserve(buf, res)
+			if _, err = w.Write(text); err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if !bytes.Equal(buf.Bytes(), original) {
+				t.Errorf("Expected '%s' (%s, BOM %d) to be written back as is", f.name, res.Name, res.BOMLen)
+			}
+		}
+	}
+
+	var res Result
+	text, _ := ioutil.ReadAll(NewReader(bytes.NewReader([]byte("\x93Caf\xe9\x94")), Detected(&res)))
+	buf := new(bytes.Buffer)
+	w := Preserve(buf, res)
+	w.Write(text)
+	w.Close()
+	if buf.String() != "\x93Caf\xe9\x94" || res.Name != "windows-1252" {
+		t.Errorf("Expected windows-1252 content to be written back as is, but got %s %q", res.Name, buf.String())
+	}
+
+	binary := []byte("\x00\x01\xff\xfe\x80PK\x03\x04\xc3")
+	res = Result{}
+	content, _ := ioutil.ReadAll(NewReader(bytes.NewReader(binary), Detected(&res)))
+	buf.Reset()
+	w = Preserve(buf, res)
+	if _, err := w.Write(content); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if !res.IsBinary || !bytes.Equal(buf.Bytes(), binary) {
+		t.Errorf("Expected binary content to be written back as is, but got %v %q", res.IsBinary, buf.Bytes())
+	}
+}
@@ -0,0 +1,599 @@
+package walker
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/encoding"
+)
+
+// ImpliedDirs gives directories that are only implied by the slash separated
+// member names of an archive. Directory names end with a slash, as member
+// names of directories do.
+func ImpliedDirs(names []string) []string {
+	seen := map[string]bool{}
+	for _, n := range names {
+		seen[n] = true
+	}
+	dirs := []string{}
+	for _, n := range names {
+		name := strings.TrimSuffix(n, "/")
+		for i := strings.LastIndex(name, "/"); i > 0; i = strings.LastIndex(name, "/") {
+			name = name[:i]
+			if seen[name+"/"] {
+				break
+			}
+			seen[name+"/"] = true
+			dirs = append(dirs, name+"/")
+		}
+	}
+	return dirs
+}
+
+// CleanName gives the member name as a relative slash separated path:
+// leading slashes, "." elements and ".." elements that climb above the
+// archive root are dropped, so members can't escape the archive. Directory
+// names end with a slash. It returns "" for the archive root itself.
+func CleanName(name string, dir bool) string {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if name == "" || !dir {
+		return name
+	}
+	return name + "/"
+}
+
+// dirInfo describes a directory implied by archive member names
+type dirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+// DirInfo gives the file info of a directory implied by archive member names
+func DirInfo(name string, modTime time.Time) os.FileInfo {
+	return dirInfo{name: path.Base(strings.TrimSuffix(name, "/")), modTime: modTime}
+}
+
+func (d dirInfo) Name() string       { return d.name }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() os.FileMode  { return os.ModeDir | 0755 }
+func (d dirInfo) ModTime() time.Time { return d.modTime }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() interface{}   { return nil }
+
+// Member is an entry of an archive, or a directory implied by entry names
+type Member struct {
+	Name   string      // slash separated name, with a trailing slash for directories
+	Info   os.FileInfo // file info of the entry, nil for damaged entries
+	Header interface{} // format specific header, nil for implied directories
+	Index  int         // position in the archive, -1 for implied directories
+	Err    error       // error reading a damaged entry, reported by Items instead of the member
+}
+
+// MemberOpener gives the format specific parts of an archive walker
+type MemberOpener interface {
+	OpenMember(m *Member, path string) (io.ReadCloser, error) // Give a reader on the member content
+	MemberMeta(m *Member) Meta                                // Give the member metadata
+}
+
+// MemberChecker is implemented by formats whose entries are checked when
+// they are walked, like zip local headers. Damaged entries are reported to
+// the error handler instead of being sent.
+type MemberChecker interface {
+	CheckMember(m *Member) error // Give the error of a damaged entry
+}
+
+// SectionOpener is implemented by formats storing members as is. Their
+// content is read directly from the archive file, without spooling.
+type SectionOpener interface {
+	OpenSection(m *Member) *io.SectionReader // Give the member content, nil when it must be decoded
+}
+
+// Archive implements the parts common to archive walkers: members are
+// emitted in the directory mode, looked up by name, and items and readers
+// are tracked until the archive resources can be released.
+type Archive struct {
+	path    string       // archive path
+	members []*Member    // archive members
+	opener  MemberOpener // format specific parts
+	items   *Tracker     // Keep track of emitted items, prevent releasing the archive before all items are closed
+	options Options
+	err     error // error that has aborted the walk
+
+	indexOnce sync.Once
+	index     map[string]*Member // members by name without trailing slash, implied directories included
+}
+
+// NewArchive gives the walker of the archive members. Release is called
+// once the archive and all its items and readers are closed.
+func NewArchive(path string, members []*Member, opener MemberOpener, release func() error, o Options) *Archive {
+	return &Archive{
+		path:    path,
+		members: members,
+		opener:  opener,
+		items:   NewTracker(release, o),
+		options: o,
+	}
+}
+
+// Close the archive.
+// It returns immediately. The archive itself is released when
+// all items are closed.
+func (a *Archive) Close() {
+	a.items.Close()
+}
+
+// CloseWait closes the archive and waits until all items are
+// closed, or the context is done. In that case, the returned *LeakError
+// lists items still open.
+func (a *Archive) CloseWait(ctx context.Context) error {
+	a.items.Close()
+	return a.items.Wait(ctx)
+}
+
+// Err returns the error that has aborted the walk
+func (a *Archive) Err() error {
+	return a.err
+}
+
+// Items sends archive members through the channel.
+// Damaged entries are reported to the error handler in their turn. Entries
+// whose header can't be read at all come last.
+func (a *Archive) Items() chan WalkItem {
+	out := make(chan WalkItem)
+	go func() {
+		members := a.members
+		if a.options.DirMode != NoDirs {
+			members = withImpliedDirs(members)
+		}
+		dirs := DirStack{}
+		for _, m := range members {
+			if err := a.check(m); err != nil {
+				if a.err = a.options.Fail(err); a.err != nil {
+					break
+				}
+				continue
+			}
+			item := a.newItem(m)
+			if a.options.DirMode == DirsPostOrder {
+				dirs.Pop(item.path, out)
+			}
+			if m.Info.IsDir() {
+				switch a.options.DirMode {
+				case DirsPreOrder:
+					a.items.Add(item, item.path)
+					out <- item
+				case DirsPostOrder:
+					a.items.Add(item, item.path)
+					dirs.Push(item)
+				}
+				continue
+			}
+			a.items.Add(item, item.path) // Remember that we have emitted an Item
+			out <- item
+		}
+		if a.err == nil {
+			dirs.Flush(out)
+		}
+		close(out)
+	}()
+	return out
+}
+
+// check gives the error of a damaged member, nil for others
+func (a *Archive) check(m *Member) *Error {
+	err := m.Err
+	if checker, ok := a.opener.(MemberChecker); ok && err == nil && m.Header != nil && !m.Info.IsDir() {
+		err = checker.CheckMember(m)
+	}
+	if err == nil {
+		return nil
+	}
+	return &Error{Path: filepath.Join(a.path, m.Name), Member: m.Name, Op: "read header", Err: err}
+}
+
+func (a *Archive) newItem(m *Member) *ArchiveItem {
+	return &ArchiveItem{
+		FileInfo: m.Info,
+		member:   m,
+		path:     filepath.Join(a.path, m.Name),
+		archive:  a,
+	}
+}
+
+// entry gives the named member
+func (a *Archive) entry(name string) (*Member, error) {
+	a.indexOnce.Do(func() {
+		a.index = map[string]*Member{}
+		for _, m := range withImpliedDirs(a.members) {
+			if m.Err == nil {
+				a.index[strings.TrimSuffix(m.Name, "/")] = m
+			}
+		}
+	})
+	m, ok := a.index[strings.Trim(filepath.ToSlash(name), "/")]
+	if !ok {
+		return nil, &os.PathError{Op: "lookup", Path: filepath.Join(a.path, name), Err: os.ErrNotExist}
+	}
+	return m, nil
+}
+
+// Stat gives the file info of the named member
+// implements Finder
+func (a *Archive) Stat(name string) (os.FileInfo, error) {
+	m, err := a.entry(name)
+	if err != nil {
+		return nil, err
+	}
+	return m.Info, nil
+}
+
+// Lookup gives the named member of the archive
+// implements Finder
+func (a *Archive) Lookup(name string) (WalkItem, error) {
+	m, err := a.entry(name)
+	if err != nil {
+		return nil, err
+	}
+	item := a.newItem(m)
+	a.items.Add(item, item.path) // Remember that we have emitted an Item
+	return item, nil
+}
+
+// withImpliedDirs returns archive members sorted in a way that directories
+// precede their content. Directories that are only implied by member names
+// are added. Damaged entries without name come last.
+func withImpliedDirs(members []*Member) []*Member {
+	names := make([]string, len(members))
+	for i, m := range members {
+		names[i] = m.Name
+	}
+	all := append([]*Member{}, members...)
+	for _, d := range ImpliedDirs(names) {
+		all = append(all, &Member{Name: d, Info: DirInfo(d, time.Time{}), Index: -1})
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Name == "" || all[j].Name == "" {
+			return all[j].Name == "" && all[i].Name != ""
+		}
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+// ArchiveItem is an item returned by Archive.Items.
+type ArchiveItem struct {
+	archive     *Archive // archive of the item
+	member      *Member  // Item entry
+	os.FileInfo          // Current entry info
+	path        string   // file path made by archive path and file path in the archive
+	readers     Closers  // The readers given by Reader
+	closeOnce   sync.Once
+	contentType contentTypeCache // Content type given by ContentType
+}
+
+// contentTypes gives the content type kept by the item
+func (i *ArchiveItem) contentTypes() *contentTypeCache {
+	return &i.contentType
+}
+
+// MemberName returns archive member name only
+func (i *ArchiveItem) MemberName() string {
+	return string(filepath.Separator) + filepath.FromSlash(strings.TrimSuffix(i.member.Name, "/"))
+}
+
+// FullName returns the item full name relative the folder path used for scanning
+func (i *ArchiveItem) FullName() string {
+	return i.path
+}
+
+// Open gives an independent reader on the archive Item. The archive
+// is kept open until the reader is closed, even if the item is closed before.
+func (i *ArchiveItem) Open() (io.ReadCloser, error) {
+	if i.IsDir() {
+		return nil, ErrIsDirectory
+	}
+	if r := i.section(); r != nil {
+		return r, nil
+	}
+	rc, err := i.archive.opener.OpenMember(i.member, i.path)
+	if err != nil {
+		return nil, err
+	}
+	r := &archiveReader{ReadCloser: rc, items: i.archive.items}
+	i.archive.items.Add(r, i.path+" (reader)")
+	return r, nil
+}
+
+// OpenRandom gives random access on the archive Item. Members stored as is
+// are read directly from the archive, others are spooled into a temporary file.
+// implements RandomAccess
+func (i *ArchiveItem) OpenRandom() (ReadSeekAtCloser, error) {
+	if i.IsDir() {
+		return nil, ErrIsDirectory
+	}
+	if r := i.section(); r != nil {
+		return r, nil
+	}
+	limit := i.archive.options.SpoolLimit
+	if i.Size() > limit {
+		return nil, errors.Wrapf(ErrTooLarge, "Can't spool '%s'", i.path)
+	}
+	rc, err := i.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return Spool(rc, limit)
+}
+
+// section gives a reader on the member content read directly from the
+// archive, or nil
+func (i *ArchiveItem) section() *archiveSection {
+	opener, ok := i.archive.opener.(SectionOpener)
+	if !ok {
+		return nil
+	}
+	s := opener.OpenSection(i.member)
+	if s == nil {
+		return nil
+	}
+	r := &archiveSection{SectionReader: s, items: i.archive.items}
+	i.archive.items.Add(r, i.path+" (reader)")
+	return r
+}
+
+// RawReader give a Reader on the exact bytes of the archive Item
+// The reader will be closed when calling Close().
+func (i *ArchiveItem) RawReader() (io.Reader, error) {
+	r, err := i.Open()
+	if err != nil {
+		return nil, err
+	}
+	i.readers.Add(r)
+	return r, nil
+}
+
+// TextReader give a Reader on the archive Item content converted into UTF-8
+// The reader will be closed when calling Close().
+func (i *ArchiveItem) TextReader(opts ...encoding.Option) (io.Reader, error) {
+	r, err := i.RawReader()
+	if err != nil {
+		return nil, err
+	}
+	return encoding.NewReader(r, opts...), nil
+}
+
+// Reader give a Reader on the exact bytes of the archive Item, like RawReader.
+// The reader will be closed when calling Close().
+//
+// Deprecated: use TextReader or RawReader
+func (i *ArchiveItem) Reader() (io.Reader, error) {
+	return i.RawReader()
+}
+
+// Close closes the item's readers, and release it.
+// Closing the item permits to close the archive when
+// all items have been closed. Closing an item twice is harmless.
+func (i *ArchiveItem) Close() {
+	i.closeOnce.Do(func() {
+		i.readers.Close()
+		i.archive.items.Done(i) // Release the item
+	})
+}
+
+// Meta gives the metadata recorded in the member header
+func (i *ArchiveItem) Meta() Meta {
+	if i.member.Header == nil {
+		return Meta{}
+	}
+	return i.archive.opener.MemberMeta(i.member)
+}
+
+// String returns the full path
+func (i *ArchiveItem) String() string {
+	return i.path
+}
+
+// Clone item
+func (i *ArchiveItem) Clone() WalkItem {
+	n := i.archive.newItem(i.member)
+	i.archive.items.Add(n, n.path) // Remember that we have emitted an Item
+	return n
+}
+
+// archiveSection releases its reference on the archive when closed
+type archiveSection struct {
+	*io.SectionReader
+	items *Tracker
+	once  sync.Once
+}
+
+// Close releases the reader. Closing a reader twice is harmless.
+func (r *archiveSection) Close() error {
+	r.once.Do(func() {
+		r.items.Done(r)
+	})
+	return nil
+}
+
+// archiveReader releases its reference on the archive when closed
+type archiveReader struct {
+	io.ReadCloser
+	items *Tracker
+	once  sync.Once
+}
+
+// Close closes the member reader. Closing a reader twice is harmless.
+func (r *archiveReader) Close() error {
+	var err error
+	r.once.Do(func() {
+		err = r.ReadCloser.Close()
+		r.items.Done(r)
+	})
+	return err
+}
+
+// Keyring holds the candidate passwords of an archive. The last password
+// that fits is tried first.
+type Keyring struct {
+	once      sync.Once
+	load      func() []string
+	mu        sync.Mutex
+	passwords []string
+	promoted  bool // a password has fit
+}
+
+// NewKeyring gives the keyring of the archive at path. The given passwords
+// are tried before the ones of the Passwords option, which are asked for on
+// the first use.
+func NewKeyring(path string, o Options, passwords ...string) *Keyring {
+	return &Keyring{
+		load: func() []string {
+			if o.Passwords == nil {
+				return passwords
+			}
+			return append(append([]string{}, passwords...), o.Passwords(path)...)
+		},
+	}
+}
+
+// Candidates gives passwords in the order they should be tried
+func (k *Keyring) Candidates() []string {
+	k.once.Do(k.fill)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return append([]string{}, k.passwords...)
+}
+
+func (k *Keyring) fill() {
+	k.passwords = k.load()
+}
+
+// Promote makes the password tried first for next members
+func (k *Keyring) Promote(password string) {
+	k.once.Do(k.fill)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for n, p := range k.passwords {
+		if p == password {
+			k.passwords[0], k.passwords[n] = k.passwords[n], k.passwords[0]
+			k.promoted = true
+			return
+		}
+	}
+}
+
+// Promoted tells if a password has already fit
+func (k *Keyring) Promoted() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.promoted
+}
+
+// Stream is a decoder reading archive members in the archive order
+type Stream interface {
+	io.Reader     // Read the current member
+	Next() error  // Move to the next member
+	Close() error // Release the decoder
+}
+
+// Streams keeps the decoder of the last member read, to continue from there
+// when members are opened in the archive order. Formats whose members are
+// decoded from the start of the archive, like solid or compressed ones,
+// don't decode the archive again for each member.
+type Streams struct {
+	mu     sync.Mutex
+	idle   Stream // decoder after the member at pos, nil when none
+	key    string // password of the idle decoder
+	pos    int
+	closed bool
+}
+
+// Open gives a reader on the member at index, for the decoder of the given
+// password. A new decoder is started by start when the idle one has gone
+// past the member.
+func (s *Streams) Open(index int, key string, start func() (Stream, error)) (io.ReadCloser, error) {
+	s.mu.Lock()
+	st, pos, idleKey := s.idle, s.pos, s.key
+	s.idle = nil
+	s.mu.Unlock()
+	if st != nil && (key != idleKey || pos >= index) {
+		st.Close()
+		st = nil
+	}
+	if st == nil {
+		var err error
+		if st, err = start(); err != nil {
+			return nil, err
+		}
+		pos = -1
+	}
+	for ; pos < index; pos++ {
+		if err := st.Next(); err != nil {
+			st.Close()
+			return nil, err
+		}
+	}
+	return &streamReader{Stream: st, streams: s, key: key, pos: index}, nil
+}
+
+// Close closes the idle decoder. Readers closed after are not kept.
+func (s *Streams) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.idle == nil {
+		return nil
+	}
+	err := s.idle.Close()
+	s.idle = nil
+	return err
+}
+
+// streamReader gives back its decoder to Streams when closed, unless a read
+// has failed
+type streamReader struct {
+	Stream
+	streams *Streams
+	key     string
+	pos     int
+	err     error
+	once    sync.Once
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	n, err := r.Stream.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// Close keeps the decoder for next members. Closing a reader twice is harmless.
+func (r *streamReader) Close() error {
+	var err error
+	r.once.Do(func() {
+		s := r.streams
+		s.mu.Lock()
+		if r.err != nil || s.closed {
+			s.mu.Unlock()
+			err = r.Stream.Close()
+			return
+		}
+		previous := s.idle
+		s.idle, s.key, s.pos = r.Stream, r.key, r.pos
+		s.mu.Unlock()
+		if previous != nil {
+			err = previous.Close()
+		}
+	})
+	return err
+}
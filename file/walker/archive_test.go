@@ -0,0 +1,109 @@
+package walker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImpliedDirs(t *testing.T) {
+	names := []string{"a/b/c.txt", "a/d.txt", "e/", "e/f/g.txt", "h.txt"}
+	got := ImpliedDirs(names)
+	sort.Strings(got)
+	expected := []string{"a/", "a/b/", "e/f/"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %#q, but got %#q", expected, got)
+	}
+	info := DirInfo("a/b/", time.Time{})
+	if !info.IsDir() || info.Name() != "b" {
+		t.Errorf("Expected directory b, but got %s, %v", info.Name(), info.Mode())
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	cases := []struct {
+		name     string
+		dir      bool
+		expected string
+	}{
+		{"a/b.txt", false, "a/b.txt"},
+		{"./a/./b.txt", false, "a/b.txt"},
+		{"/etc/passwd", false, "etc/passwd"},
+		{"../../../../e", false, "e"},
+		{"a/../../b/", true, "b/"},
+		{"a/b", true, "a/b/"},
+		{"./", true, ""},
+		{"..", false, ""},
+	}
+	for _, c := range cases {
+		if got := CleanName(c.name, c.dir); got != c.expected {
+			t.Errorf("Expected %q for %q, but got %q", c.expected, c.name, got)
+		}
+	}
+}
+
+// fakeStream gives members named by their index
+type fakeStream struct {
+	*strings.Reader
+	pos    int
+	starts *int
+	nexts  *int
+}
+
+func (s *fakeStream) Next() error {
+	s.pos++
+	*s.nexts++
+	s.Reader = strings.NewReader(fmt.Sprint(s.pos))
+	return nil
+}
+
+func (s *fakeStream) Close() error { return nil }
+
+func TestStreams(t *testing.T) {
+	starts, nexts := 0, 0
+	start := func() (Stream, error) {
+		starts++
+		return &fakeStream{pos: -1, starts: &starts, nexts: &nexts}, nil
+	}
+	s := &Streams{}
+	read := func(index int, key string) {
+		r, err := s.Open(index, key, start)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if b, _ := ioutil.ReadAll(r); string(b) != fmt.Sprint(index) {
+			t.Errorf("Expected member %d, but got %q", index, b)
+		}
+		r.Close()
+	}
+	for index := 0; index < 10; index++ {
+		read(index, "")
+	}
+	if starts != 1 || nexts != 10 {
+		t.Errorf("Expected one decoder moving through 10 members, but got %d decoder(s) and %d moves", starts, nexts)
+	}
+	read(3, "")        // Going back restarts
+	read(4, "another") // So does another password
+	if starts != 3 || nexts != 19 {
+		t.Errorf("Expected 3 decoders and 19 moves, but got %d and %d", starts, nexts)
+	}
+	s.Close()
+}
+
+func TestKeyring(t *testing.T) {
+	k := NewKeyring("archive.zip", NewOptions(Passwords("a", "b")), "")
+	if k.Promoted() {
+		t.Errorf("Expected no password to have fit yet")
+	}
+	k.Promote("b")
+	if !k.Promoted() {
+		t.Errorf("Expected a password to have fit")
+	}
+	if got := k.Candidates(); !reflect.DeepEqual(got, []string{"b", "a", ""}) {
+		t.Errorf("Expected the promoted password first, but got %q", got)
+	}
+}
@@ -0,0 +1,82 @@
+package walker
+
+import (
+	"io"
+	"sync"
+
+	"github.com/simulot/golib/file/encoding"
+)
+
+// DirectoryContentType is the content type of directory items
+const DirectoryContentType = "inode/directory"
+
+// Classify gives the charset of the item content, detected from its first
+// sniffLen bytes, or encoding.DefaultSniffLen when sniffLen isn't positive.
+func Classify(item WalkItem, sniffLen int) (encoding.Result, error) {
+	if item.IsDir() {
+		return encoding.Result{}, ErrIsDirectory
+	}
+	r, err := item.Open()
+	if err != nil {
+		return encoding.Result{}, err
+	}
+	defer r.Close()
+	res, _, err := encoding.Sniff(r, sniffLen)
+	return res, err
+}
+
+// IsText tells if the item is a file whose content is text. Directories
+// and items that can't be read aren't text.
+func IsText(item WalkItem, sniffLen int) bool {
+	res, err := Classify(item, sniffLen)
+	return err == nil && !res.IsBinary
+}
+
+// contentTypeCache keeps the content type of an item once sniffed
+type contentTypeCache struct {
+	mu sync.Mutex
+	ct string
+}
+
+// contentTyped is implemented by items keeping their content type
+type contentTyped interface {
+	contentTypes() *contentTypeCache
+}
+
+// ContentType gives the MIME type of the item content, sniffed from its
+// first bytes. The content type is kept by the item for next calls.
+func ContentType(item WalkItem) (string, error) {
+	if item.IsDir() {
+		return DirectoryContentType, nil
+	}
+	c, ok := item.(contentTyped)
+	if !ok {
+		return sniffContentType(item)
+	}
+	cache := c.contentTypes()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.ct != "" {
+		return cache.ct, nil
+	}
+	ct, err := sniffContentType(item)
+	if err == nil {
+		cache.ct = ct
+	}
+	return ct, err
+}
+
+// sniffContentType reads the first bytes of the item to give its content type
+func sniffContentType(item WalkItem) (string, error) {
+	r, err := item.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data := make([]byte, encoding.DefaultSniffLen)
+	n, err := io.ReadFull(r, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", &Error{Path: item.FullName(), Op: "sniff", Err: err}
+	}
+	return encoding.SniffContentType(data[:n], n == len(data)), nil
+}
@@ -0,0 +1,85 @@
+package walker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"text.txt":  []byte("Hello world\n"),
+		"utf16.txt": []byte("\xff\xfeH\x00i\x00"),
+		"image.png": []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := Open(dir, Dirs(DirsPreOrder))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	got := map[string]bool{}
+	for item := range w.Items() {
+		got[item.Name()] = IsText(item, 0)
+		if item.Name() == "utf16.txt" {
+			if res, err := Classify(item, 16); err != nil || res.Name != "UTF-16LE" {
+				t.Errorf("Expected UTF-16LE, but got %v, %v", res.Name, err)
+			}
+		}
+		item.Close()
+	}
+	w.Close()
+	expected := map[string]bool{filepath.Base(dir): false, "text.txt": true, "utf16.txt": true, "image.png": false}
+	for name, text := range expected {
+		if got[name] != text {
+			t.Errorf("Expected IsText of '%s' to be %v", name, text)
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"text.txt":  []byte("Hello world\n"),
+		"image.dat": []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := map[string]string{
+		"":          DirectoryContentType,
+		"text.txt":  "text/plain; charset=utf-8",
+		"image.dat": "image/png",
+	}
+	for name, ct := range expected {
+		item, err := OpenPath(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if got, err := ContentType(item); err != nil || got != ct {
+			t.Errorf("Expected content type of '%s' to be '%s', but got '%s', %v", name, ct, got, err)
+		}
+		item.Close()
+	}
+
+	// The content type is sniffed once per item
+	item, err := OpenPath(filepath.Join(dir, "text.txt"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer item.Close()
+	ContentType(item)
+	if err = os.Remove(filepath.Join(dir, "text.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ContentType(item); err != nil || got != expected["text.txt"] {
+		t.Errorf("Expected the content type kept by the item, but got '%s', %v", got, err)
+	}
+}
@@ -0,0 +1,116 @@
+// Package cpiowalker walks through cpio archives in SVR4 format, with or without CRC.
+package cpiowalker
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cavaliergopher/cpio"
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/walker"
+)
+
+// init registers cpio walker into walkers.
+func init() {
+	walker.RegisterFormat(walker.Format{
+		Name:     "cpio",
+		Opener:   Open,
+		Matcher:  Matcher,
+		Detector: Detector,
+	})
+}
+
+// Matcher returns true when the name is like .cpio. Used to recognize
+// the kind of Walker to be open.
+func Matcher(name string) bool {
+	return strings.ToLower(filepath.Ext(name)) == ".cpio"
+}
+
+// Detector returns true when the header starts with the cpio signature.
+var Detector = walker.Magic(0, "070701", "070702")
+
+// Cpio handles cpio archive as a Walker. Member contents are stored
+// uncompressed, they are read directly from the archive file.
+type Cpio struct {
+	*walker.Archive
+	file *os.File // archive file
+}
+
+// countingReader counts bytes read from the archive
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// header is the member header with its content offset in the archive
+type header struct {
+	*cpio.Header
+	offset int64
+}
+
+// Open opens a cpio archive at path. Headers are read at once to locate
+// member contents. A damaged header ends the archive, it is reported by Items.
+func Open(path string, opts ...walker.Option) (walker.Walker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't open cpio")
+	}
+	members := []*walker.Member{}
+	counter := &countingReader{r: bufio.NewReader(file)}
+	r := cpio.NewReader(counter)
+	for index := 0; ; index++ {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && len(members) == 0 {
+			file.Close()
+			return nil, errors.Wrap(err, "Can't open cpio")
+		}
+		if err != nil {
+			// members read before the damaged header are kept
+			members = append(members, &walker.Member{Err: err, Index: index})
+			break
+		}
+		name := walker.CleanName(h.Name, h.Mode.IsDir())
+		if name == "" {
+			continue
+		}
+		members = append(members, &walker.Member{Name: name, Info: h.FileInfo(), Header: header{h, counter.n}, Index: index})
+	}
+	c := &Cpio{file: file}
+	c.Archive = walker.NewArchive(path, members, c, file.Close, walker.NewOptions(opts...))
+	return c, nil
+}
+
+// OpenMember gives a reader on the member content
+// implements walker.MemberOpener
+func (c *Cpio) OpenMember(m *walker.Member, path string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(c.OpenSection(m)), nil
+}
+
+// OpenSection gives the member content, read directly from the archive
+// implements walker.SectionOpener
+func (c *Cpio) OpenSection(m *walker.Member) *io.SectionReader {
+	h := m.Header.(header)
+	return io.NewSectionReader(c.file, h.offset, h.Size)
+}
+
+// MemberMeta gives owners and inode recorded in the member header
+// implements walker.MemberOpener
+func (c *Cpio) MemberMeta(m *walker.Member) walker.Meta {
+	h := m.Header.(header)
+	meta := walker.OwnerMeta(h.Uid, h.Guid)
+	meta[walker.MetaInode] = uint64(h.Inode)
+	return meta
+}
@@ -0,0 +1,15 @@
+package cpiowalker
+
+import (
+	"testing"
+
+	"github.com/simulot/golib/file/walker"
+	"github.com/simulot/golib/file/walker/walkertest"
+)
+
+func TestCpio(t *testing.T) {
+	walkertest.Archive(t, Open,
+		walkertest.Case{Path: "test/flat.cpio", Names: walkertest.FlatNames},
+		walkertest.Case{Path: "test/tree.cpio", Names: walkertest.TreeNames, Meta: []string{walker.MetaUID, walker.MetaGID, walker.MetaInode}},
+	)
+}
@@ -0,0 +1,12 @@
+#!/bin/bash
+# Test archives are made with bsdtar from walker test folders
+rm -rf test
+mkdir test
+
+pushd ../test/tree
+bsdtar --format newc -cf ../../cpiowalker/test/tree.cpio *
+popd
+
+pushd ../test/flat
+bsdtar --format newc -cf ../../cpiowalker/test/flat.cpio *
+popd
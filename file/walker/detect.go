@@ -0,0 +1,117 @@
+package walker
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is the length of the file header given to detectors
+const sniffLen = 4096
+
+// Descend makes files with the given extensions candidates for detection,
+// cancelling a previous NoDescend on them.
+//
+// Deprecated: every regular file is sniffed unless its extension is opted
+// out by NoDescend.
+func Descend(extensions ...string) Option {
+	return func(o *Options) {
+		for _, e := range extensions {
+			o.Descent[strings.ToLower(e)] = true
+		}
+	}
+}
+
+// NoDescend prevents walkers from descending into files with the given
+// extensions, whatever their content
+func NoDescend(extensions ...string) Option {
+	return func(o *Options) {
+		for _, e := range extensions {
+			o.Descent[strings.ToLower(e)] = false
+		}
+	}
+}
+
+// Detect gives the format of the container at path. The header of regular
+// files is sniffed by registered detectors. Formats without detector are
+// recognized by their matcher.
+// It returns false when the file isn't a container, or when its extension
+// is opted out by options.
+func Detect(path string, opts ...Option) (Format, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Format{}, false
+	}
+	return detect(path, info.Mode().Type(), NewOptions(opts...))
+}
+
+// detect gives the format of the file, unless its extension is opted out.
+// typ gives the file type bits, only regular files are sniffed.
+func detect(path string, typ os.FileMode, o Options) (Format, bool) {
+	if descend, set := o.Descent[strings.ToLower(filepath.Ext(path))]; set && !descend {
+		return Format{}, false
+	}
+	return identify(path, typ, o.Registry.Formats())
+}
+
+// detectContainer gives the format of the file explicitly designated as a
+// container, whatever its extension
+func detectContainer(path string, o Options) (Format, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Format{}, false
+	}
+	return identify(path, info.Mode().Type(), o.Registry.Formats())
+}
+
+// identify gives the format whose detector recognizes the file header, or
+// the format without detector whose matcher accepts the name
+func identify(path string, typ os.FileMode, formats []Format) (Format, bool) {
+	if f, ok := sniff(path, typ, formats); ok {
+		return f, true
+	}
+	return match(path, formats)
+}
+
+// match gives the first format without detector whose matcher accepts the name
+func match(path string, formats []Format) (Format, bool) {
+	for _, f := range formats {
+		if f.Detector == nil && f.Matcher != nil && f.Matcher(path) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// sniff gives the first format whose detector recognizes the file header
+func sniff(path string, typ os.FileMode, formats []Format) (Format, bool) {
+	if !typ.IsRegular() {
+		return Format{}, false
+	}
+	header := readHeader(path)
+	if header == nil {
+		return Format{}, false
+	}
+	for _, f := range formats {
+		if f.Detector != nil && f.Detector(header) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// readHeader gives the first bytes of a file, nil when it can't be read
+func readHeader(path string) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil
+	}
+	return header[:n]
+}
@@ -0,0 +1,71 @@
+package walker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMagic(t *testing.T) {
+	d := Magic(2, "ab", "cd")
+	cases := []struct {
+		header   string
+		expected bool
+	}{
+		{"xxab", true},
+		{"xxcdyy", true},
+		{"xxa", false},
+		{"abxx", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if got := d([]byte(c.header)); got != c.expected {
+			t.Errorf("Expected %v for '%s', but got %v", c.expected, c.header, got)
+		}
+	}
+}
+
+func TestDetectPriority(t *testing.T) {
+	r := NewRegistry()
+	r.Register(Format{Name: "generic", Detector: Magic(0, "MAG")})
+	r.Register(Format{Name: "specific", Detector: Magic(0, "MAGIC"), Priority: 10})
+	r.Register(Format{Name: "byname", Matcher: func(name string) bool { return filepath.Ext(name) == ".bn" }})
+	r.Register(Format{Name: "both", Detector: Magic(0, "BOTH"), Matcher: func(name string) bool { return filepath.Ext(name) == ".bo" }})
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.dat": "MAGIC content",
+		"b.dat": "MAG content",
+		"c.bn":  "MAGIC content",
+		"d.bn":  "plain content",
+		"e.dat": "plain content",
+		"f.bo":  "plain content",
+		"g.dat": "BOTH content",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := map[string]string{
+		"a.dat": "specific",
+		"b.dat": "generic",
+		"c.bn":  "specific",
+		"d.bn":  "byname",
+		"e.dat": "",
+		"f.bo":  "",
+		"g.dat": "both",
+	}
+	for name, format := range expected {
+		f, ok := Detect(filepath.Join(dir, name), UseRegistry(r))
+		if ok != (format != "") || f.Name != format {
+			t.Errorf("Expected '%s' to be detected as %q, but got %q, %v", name, format, f.Name, ok)
+		}
+	}
+	if _, ok := Detect(filepath.Join(dir, "c.bn"), UseRegistry(r), NoDescend(".bn")); ok {
+		t.Errorf("Expected 'c.bn' not to be detected with NoDescend")
+	}
+	if f, ok := Detect(filepath.Join(dir, "c.bn"), UseRegistry(r), NoDescend(".bn"), Descend(".bn")); !ok || f.Name != "specific" {
+		t.Errorf("Expected Descend to cancel NoDescend, but got %q, %v", f.Name, ok)
+	}
+}
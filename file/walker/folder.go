@@ -11,20 +11,26 @@ import (
 
 // Folder handles a classical folder as provided by os file system.
 type Folder struct {
-	path string
+	path    string
+	opts    []Option // given to archive walkers
+	options Options
+	err     error // error that has aborted the walk
 }
 
 // Open opens a folder provided by os package
-func Open(path string) (*Folder, error) {
+func Open(path string, opts ...Option) (*Folder, error) {
 	_, err := os.Stat(path)
 	if err != nil {
 		return nil, errors.Wrap(err, "Can't stat path in Folder.Open")
 	}
 
 	f := &Folder{
-		path: path,
+		path:    path,
+		options: NewOptions(opts...),
 	}
-
+	// Archive walkers share the serialized handler
+	f.options.OnError = serialize(f.options.OnError)
+	f.opts = append(append([]Option{}, opts...), OnError(f.options.OnError))
 	return f, nil
 }
 
@@ -32,47 +38,138 @@ func Open(path string) (*Folder, error) {
 // implements Walker interface
 func (f *Folder) Close() {}
 
-// Items send folder content through a channel
+// Err returns the error that has aborted the walk
+// implements Walker
+func (f *Folder) Err() error {
+	return f.err
+}
+
+// fail reports an entry error to the error handler
+func (f *Folder) fail(path, op string, err error) error {
+	return f.options.Fail(&Error{Path: path, Op: op, Err: err})
+}
+
+// Items send folder content through a channel.
+// Registered archives are open and their content is sent as well.
+// Entries that can't be read are reported to the error handler.
+// When Workers option is greater than 1, several directories are read at once.
 // implements Walker
-func (f *Folder) Items() chan Walker {
-	out := make(chan Walker)
+func (f *Folder) Items() chan WalkItem {
+	out := make(chan WalkItem)
 	go func() {
-		filepath.Walk(f.path, func(path string, info os.FileInfo, err error) error {
-			if info.IsDir() || err != nil {
-				return err
-			}
-			// check if the current file is an registered container
-			if len(walkerRegister) > 0 {
-				for _, d := range walkerRegister {
-					if d.Matcher(path) {
-						o, err := d.Opener(path)
-						if err != nil {
-							return err
-						}
-						out <- o
-						return nil
-					}
-				}
-			}
-			// this is a regular file...
-			o, err := FileWalkerOpen(path)
-			if err != nil {
-				return err
-			}
-			out <- o
-			return nil
-		})
+		if f.options.Workers > 1 {
+			f.err = f.parallelWalk(out)
+		} else {
+			f.err = f.walk(out)
+		}
 		close(out)
 	}()
 
 	return out
 }
 
+// walk sends folder content using filepath.Walk
+func (f *Folder) walk(out chan WalkItem) error {
+	dirs := DirStack{}
+	err := filepath.Walk(f.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return f.fail(path, "walk", err)
+		}
+		if f.options.DirMode == DirsPostOrder {
+			dirs.Pop(path, out)
+		}
+		if info.IsDir() {
+			if path == f.path {
+				return nil
+			}
+			switch f.options.DirMode {
+			case DirsPreOrder:
+				out <- &Item{FileInfo: info, path: path}
+			case DirsPostOrder:
+				dirs.Push(&Item{FileInfo: info, path: path})
+			}
+			return nil
+		}
+		return f.emitFile(path, info, info.Mode().Type(), out)
+	})
+	if err == nil {
+		dirs.Flush(out)
+	}
+	return err
+}
+
+// emitFile sends the file item, or the archive content when the file is
+// a registered container. typ gives the file type bits.
+func (f *Folder) emitFile(path string, info os.FileInfo, typ os.FileMode, out chan WalkItem) error {
+	if typ&os.ModeSymlink != 0 {
+		target, err := os.Stat(path)
+		if err != nil {
+			return f.fail(path, "stat", err)
+		}
+		typ = target.Mode().Type()
+	}
+	// check if the current file is an registered container
+	if d, ok := detect(path, typ, f.options); ok {
+		f.options.Logger.Debug("Walking container", "file", path, "format", d.Name)
+		w, err := d.Opener(path, f.opts...)
+		if err != nil {
+			return f.fail(path, "open", err)
+		}
+		for item := range w.Items() {
+			out <- item
+		}
+		w.Close()
+		// The archive walker has already consulted the error handler
+		return w.Err()
+	}
+	// this is a regular file...
+	out <- &Item{
+		FileInfo: info,
+		path:     path,
+	}
+	return nil
+}
+
+// Stat gives the file info of the named file of the folder
+// implements Finder
+func (f *Folder) Stat(name string) (os.FileInfo, error) {
+	path, err := f.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(path)
+}
+
+// Lookup gives the named file of the folder
+// implements Finder
+func (f *Folder) Lookup(name string) (WalkItem, error) {
+	path, err := f.resolve("lookup", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Item{FileInfo: info, path: path}, nil
+}
+
+// resolve gives the path of the named file. Names leaving the folder,
+// like "../x" or "/x", are rejected.
+func (f *Folder) resolve(op, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if name != "" && !filepath.IsLocal(name) {
+		return "", &os.PathError{Op: op, Path: name, Err: ErrOutsideRoot}
+	}
+	return filepath.Join(f.path, name), nil
+}
+
 // Item is an item returned by Folder Scanner. It contains path relative to opening path
 type Item struct {
 	os.FileInfo
-	path string
-	file io.ReadCloser
+	path        string
+	readers     Closers          // Readers given by Reader
+	contentType contentTypeCache // Content type given by ContentType
 }
 
 // String implements stringer interface
@@ -90,25 +187,67 @@ func (i *Item) MemberName() string {
 	return i.path
 }
 
-// Reader opens the file pointed by the Folder Item
-func (i *Item) Reader() (io.Reader, error) {
-	var err error
-	if i.file != nil {
-		panic(i.path + " is already open")
+// Open opens the file pointed by the Folder Item. Each call gives
+// an independent reader that must be closed.
+func (i *Item) Open() (io.ReadCloser, error) {
+	if i.IsDir() {
+		return nil, ErrIsDirectory
 	}
-	if i.file, err = os.Open(i.path); err == nil {
-		r := encoding.NewReader(i.file)
-		return r, err
+	return os.Open(i.path)
+}
+
+// OpenRandom opens the file pointed by the Folder Item for random access
+// implements RandomAccess
+func (i *Item) OpenRandom() (ReadSeekAtCloser, error) {
+	if i.IsDir() {
+		return nil, ErrIsDirectory
 	}
-	return i.file, err
+	return os.Open(i.path)
 }
 
-// Close the file pointed by the Folder Item whenever it is opened
-func (i *Item) Close() {
-	if i.file != nil {
-		i.file.Close()
+// RawReader opens the file pointed by the Folder Item, and gives its exact bytes.
+// The reader will be closed when calling Close().
+func (i *Item) RawReader() (io.Reader, error) {
+	file, err := i.Open()
+	if err != nil {
+		return nil, err
+	}
+	i.readers.Add(file)
+	return file, nil
+}
+
+// TextReader opens the file pointed by the Folder Item, and converts its content into UTF-8.
+// The reader will be closed when calling Close().
+func (i *Item) TextReader(opts ...encoding.Option) (io.Reader, error) {
+	r, err := i.RawReader()
+	if err != nil {
+		return nil, err
 	}
-	return
+	return encoding.NewReader(r, opts...), nil
+}
+
+// Reader opens the file pointed by the Folder Item, and converts its content
+// into UTF-8, like TextReader.
+// The reader will be closed when calling Close().
+//
+// Deprecated: use TextReader or RawReader
+func (i *Item) Reader() (io.Reader, error) {
+	return i.TextReader()
+}
+
+// Close the files pointed by the Folder Item whenever they are opened
+func (i *Item) Close() {
+	i.readers.Close()
+}
+
+// contentTypes gives the content type kept by the item
+func (i *Item) contentTypes() *contentTypeCache {
+	return &i.contentType
+}
+
+// Meta gives file owners and extended attributes when the platform provides them
+func (i *Item) Meta() Meta {
+	return fileMeta(i.path, i.FileInfo)
 }
 
 // Clone Item except the file.
@@ -119,16 +258,24 @@ func (i *Item) Clone() WalkItem {
 	}
 }
 
+// FileAsWalker gives a single file as a Walker
 type FileAsWalker struct {
-	path string
+	path    string
+	options Options
+	err     error
 }
 
-func FileWalkerOpen(file string) (Walker, error) {
+// FileWalkerOpen gives the file as a Walker
+func FileWalkerOpen(file string, opts ...Option) (Walker, error) {
 	return &FileAsWalker{
-		path: file,
+		path:    file,
+		options: NewOptions(opts...),
 	}, nil
 }
 
+// Items sends the file item. A file that can't be stat'ed is reported to
+// the error handler.
+// implements Walker
 func (f *FileAsWalker) Items() chan WalkItem {
 	out := make(chan WalkItem)
 	go func() {
@@ -138,9 +285,16 @@ func (f *FileAsWalker) Items() chan WalkItem {
 				FileInfo: info,
 				path:     f.path,
 			}
+		} else {
+			f.err = f.options.Fail(&Error{Path: f.path, Op: "stat", Err: err})
 		}
 		close(out)
 	}()
 	return out
 }
 func (f *FileAsWalker) Close() {}
+
+// Err gives the error that has aborted the walk
+func (f *FileAsWalker) Err() error {
+	return f.err
+}
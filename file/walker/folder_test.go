@@ -2,7 +2,14 @@ package walker
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"sort"
 	"strings"
 	"testing"
@@ -77,3 +84,299 @@ func TestFolderItemOpen(t *testing.T) {
 		})
 	}
 }
+
+func TestFolderDirs(t *testing.T) {
+	empty := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(empty, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path     string
+		mode     DirMode
+		expected []string
+	}{
+		{
+			"test/tree", NoDirs,
+			[]string{"test/tree/file_a.txt", "test/tree/file_b.txt", "test/tree/file_c.txt", "test/tree/subtree/file_d.txt", "test/tree/subtree/file_e.txt", "test/tree/subtree/file_f.txt"},
+		},
+		{
+			"test/tree", DirsPreOrder,
+			[]string{"test/tree/file_a.txt", "test/tree/file_b.txt", "test/tree/file_c.txt", "test/tree/subtree/", "test/tree/subtree/file_d.txt", "test/tree/subtree/file_e.txt", "test/tree/subtree/file_f.txt"},
+		},
+		{
+			"test/tree", DirsPostOrder,
+			[]string{"test/tree/file_a.txt", "test/tree/file_b.txt", "test/tree/file_c.txt", "test/tree/subtree/file_d.txt", "test/tree/subtree/file_e.txt", "test/tree/subtree/file_f.txt", "test/tree/subtree/"},
+		},
+		{
+			empty, DirsPreOrder,
+			[]string{filepath.Join(empty, "a") + "/", filepath.Join(empty, "a", "b") + "/"},
+		},
+		{
+			empty, DirsPostOrder,
+			[]string{filepath.Join(empty, "a", "b") + "/", filepath.Join(empty, "a") + "/"},
+		},
+	}
+
+	for _, c := range cases {
+		folder, err := Open(c.path, Dirs(c.mode))
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		got := []string{}
+		for item := range folder.Items() {
+			name := filepath.ToSlash(item.FullName())
+			if item.IsDir() {
+				name += "/"
+				if _, err := item.Reader(); err != ErrIsDirectory {
+					t.Errorf("Expected ErrIsDirectory when reading '%s', but got '%v'", name, err)
+				}
+			}
+			got = append(got, name)
+			item.Close()
+		}
+		folder.Close()
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("For '%s' with mode %d, expecting\n%#q\nbut got\n%#q", c.path, c.mode, c.expected, got)
+		}
+	}
+}
+
+func TestFolderErrors(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(Format{
+		Name: "bad",
+		Opener: func(string, ...Option) (Walker, error) {
+			return nil, errors.New("corrupted archive")
+		},
+		Matcher: func(name string) bool {
+			return filepath.Ext(name) == ".bad"
+		},
+	})
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.bad", "d.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "nowhere"), filepath.Join(dir, "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		reported := []string{}
+		folder, err := Open(dir, UseRegistry(registry), OnError(func(err error) error {
+			if e, ok := err.(*Error); ok {
+				reported = append(reported, filepath.Base(e.Path))
+			}
+			return nil
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for item := range folder.Items() {
+			got = append(got, item.Name())
+			item.Close()
+		}
+		folder.Close()
+		if folder.Err() != nil {
+			t.Errorf("Unexpected error %s", folder.Err())
+		}
+		if expected := []string{"a.txt", "d.txt"}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expecting items %#q, but got %#q", expected, got)
+		}
+		if expected := []string{"b.bad", "c.txt"}; !reflect.DeepEqual(reported, expected) {
+			t.Errorf("Expecting errors on %#q, but got %#q", expected, reported)
+		}
+	})
+
+	t.Run("log", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		folder, err := Open(dir, UseRegistry(registry), OnError(SkipErrors), WithLogger(slog.New(slog.NewTextHandler(buf, nil))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for item := range folder.Items() {
+			item.Close()
+		}
+		folder.Close()
+		logged := buf.String()
+		for _, expected := range []string{"b.bad stage=open", "c.txt stage=stat"} {
+			if !strings.Contains(logged, "msg=\"Entry skipped\" file="+filepath.Join(dir, expected)) {
+				t.Errorf("Expecting '%s' to be logged, but got %q", expected, logged)
+			}
+		}
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		folder, err := Open(dir, UseRegistry(registry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for item := range folder.Items() {
+			got = append(got, item.Name())
+			item.Close()
+		}
+		folder.Close()
+		if e, ok := folder.Err().(*Error); !ok || e.Op != "open" || filepath.Base(e.Path) != "b.bad" {
+			t.Errorf("Expecting an open error on b.bad, but got %v", folder.Err())
+		}
+		if expected := []string{"a.txt"}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expecting items %#q, but got %#q", expected, got)
+		}
+	})
+}
+
+func TestFolderLookup(t *testing.T) {
+	folder, err := Open("test/tree")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	item, err := folder.Lookup("subtree/file_d.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if expected := filepath.FromSlash("test/tree/subtree/file_d.txt"); item.FullName() != expected {
+		t.Errorf("Expected '%s', but got '%s'", expected, item.FullName())
+	}
+	item.Close()
+	if info, err := folder.Stat("subtree"); err != nil || !info.IsDir() {
+		t.Errorf("Expected subtree to be a directory, but got %v, %v", info, err)
+	}
+	if _, err := folder.Lookup("nowhere.txt"); !os.IsNotExist(err) {
+		t.Errorf("Expected not exist error, but got %v", err)
+	}
+	for _, name := range []string{"../flat/file_a.txt", "subtree/../../flat/file_a.txt", "/etc/passwd"} {
+		if _, err := folder.Lookup(name); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("Expected lookup of '%s' to be rejected, but got %v", name, err)
+		}
+		if _, err := folder.Stat(name); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("Expected stat of '%s' to be rejected, but got %v", name, err)
+		}
+	}
+}
+
+func TestFileWalker(t *testing.T) {
+	w, _ := FileWalkerOpen("test/flat/file_a.txt")
+	got := []string{}
+	for item := range w.Items() {
+		got = append(got, item.Name())
+		item.Close()
+	}
+	if expected := []string{"file_a.txt"}; !reflect.DeepEqual(got, expected) || w.Err() != nil {
+		t.Errorf("Expecting items %#q, but got %#q, %v", expected, got, w.Err())
+	}
+
+	w, _ = FileWalkerOpen("test/flat/nowhere.txt")
+	for range w.Items() {
+		t.Errorf("Expecting no item")
+	}
+	if e, ok := w.Err().(*Error); !ok || !os.IsNotExist(e.Err) {
+		t.Errorf("Expecting a not exist error, but got %v", w.Err())
+	}
+
+	w, _ = FileWalkerOpen("test/flat/nowhere.txt", OnError(SkipErrors))
+	for range w.Items() {
+	}
+	if w.Err() != nil {
+		t.Errorf("Unexpected error %s", w.Err())
+	}
+}
+
+func TestFolderItemMultipleReaders(t *testing.T) {
+	item, err := OpenPath("test/flat/file_a.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	r1, err := item.Open()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	r2, err := item.Open()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	head := make([]byte, 4)
+	r1.Read(head)
+	c2, _ := ioutil.ReadAll(r2)
+	c1, _ := ioutil.ReadAll(r1)
+	if string(head)+string(c1) != "file_a.txt\n" || string(c2) != "file_a.txt\n" {
+		t.Errorf("Expected independent readers, but got '%s'+'%s' and '%s'", head, c1, c2)
+	}
+	r1.Close()
+	r2.Close()
+	for n := 0; n < 2; n++ {
+		if _, err := item.Reader(); err != nil {
+			t.Errorf("Unexpected error %s", err)
+		}
+	}
+	item.Close()
+}
+
+func TestFolderOpenRandom(t *testing.T) {
+	item, err := OpenPath("test/flat/file_b.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer item.Close()
+	r, err := item.(RandomAccess).OpenRandom()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer r.Close()
+	b := make([]byte, 6)
+	if _, err = r.ReadAt(b, 5); err != nil || string(b) != "b.txt\n" {
+		t.Errorf("Expected 'b.txt\\n', but got '%s', %v", b, err)
+	}
+}
+
+func TestFolderRawAndTextReaders(t *testing.T) {
+	for _, name := range []string{"utf16-le.txt", "utf16-be.txt", "utf8.txt"} {
+		path := filepath.Join("..", "encoding", "testfiles", name)
+		expected, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item, err := OpenPath(path)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		raw, err := item.RawReader()
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if got, _ := ioutil.ReadAll(raw); !bytes.Equal(got, expected) {
+			t.Errorf("Expected raw content of '%s' to be unchanged", name)
+		}
+		text, err := item.TextReader()
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		line, _ := bufio.NewReader(text).ReadString('\r')
+		if line != "28/10/2016 11:54:00 : Log file opened! (BWIFaceBasic v. 1.0.202)\r" {
+			t.Errorf("Unexpected text content of '%s': '%s'", name, line)
+		}
+		item.Close()
+	}
+}
+
+func TestFolderMeta(t *testing.T) {
+	item, err := OpenPath("test/flat/file_a.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer item.Close()
+	m := item.Meta()
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if m[MetaUID] != os.Getuid() {
+		t.Errorf("Expected uid %d, but got %v", os.Getuid(), m[MetaUID])
+	}
+	if _, ok := m[MetaInode].(uint64); !ok {
+		t.Errorf("Expected inode in meta, but got %v", m[MetaInode])
+	}
+}
@@ -0,0 +1,59 @@
+package walker
+
+import (
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+// Meta gives item metadata by key. Available keys depend on the walker
+// and the platform.
+type Meta map[string]interface{}
+
+// Metadata keys
+const (
+	MetaUID    = "uid"    // int, owner user id
+	MetaGID    = "gid"    // int, owner group id
+	MetaOwner  = "owner"  // string, owner user name
+	MetaGroup  = "group"  // string, owner group name
+	MetaInode  = "inode"  // uint64, file serial number
+	MetaXattrs = "xattrs" // map[string][]byte, extended attributes
+
+	MetaComment        = "comment"         // string, archive member comment
+	MetaMethod         = "method"          // uint16, archive member compression method
+	MetaCompressedSize = "compressed_size" // uint64, archive member compressed size
+	MetaCRC32          = "crc32"           // uint32, archive member checksum
+	MetaExtra          = "extra"           // []byte, archive member extra fields
+	MetaEncrypted      = "encrypted"       // bool, archive member is encrypted
+)
+
+var (
+	userNames  sync.Map // user names by uid
+	groupNames sync.Map // group names by gid
+)
+
+// ownerNames completes meta with user and group names of uid and gid
+func ownerNames(m Meta, uid, gid int) {
+	m[MetaUID] = uid
+	m[MetaGID] = gid
+	if name, ok := userNames.Load(uid); ok {
+		m[MetaOwner] = name
+	} else if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		userNames.Store(uid, u.Username)
+		m[MetaOwner] = u.Username
+	}
+	if name, ok := groupNames.Load(gid); ok {
+		m[MetaGroup] = name
+	} else if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		groupNames.Store(gid, g.Name)
+		m[MetaGroup] = g.Name
+	}
+}
+
+// OwnerMeta gives metadata for the given uid and gid, with user and group
+// names when known by the system. It's used by archive walkers.
+func OwnerMeta(uid, gid int) Meta {
+	m := Meta{}
+	ownerNames(m, uid, gid)
+	return m
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package walker
+
+import "os"
+
+// fileMeta gives no metadata on this platform
+func fileMeta(path string, info os.FileInfo) Meta {
+	return Meta{}
+}
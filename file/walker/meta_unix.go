@@ -0,0 +1,22 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package walker
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileMeta gives owners and extended attributes of the file
+func fileMeta(path string, info os.FileInfo) Meta {
+	m := Meta{}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		ownerNames(m, int(st.Uid), int(st.Gid))
+		m[MetaInode] = uint64(st.Ino)
+	}
+	if x := xattrs(path); len(x) > 0 {
+		m[MetaXattrs] = x
+	}
+	return m
+}
@@ -0,0 +1,330 @@
+package walker
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dirNode is a directory explored by the parallel walker
+type dirNode struct {
+	path     string
+	item     *Item         // directory item, nil for the walk root
+	parent   *dirNode      // parent directory, nil for the walk root
+	pending  int32         // post-order: reads in progress in the subtree
+	entries  []os.DirEntry // ordered mode: directory content
+	children []*dirNode    // ordered mode: sub directories in entries order
+	err      error         // ordered mode: read error
+
+	once      sync.Once // ordered mode: reads the directory
+	scheduled int32     // ordered mode: read by prefetch (1) or by the emitter (2)
+	next      int       // ordered mode: first sub directory not prefetched yet
+}
+
+// aheadPerWorker bounds the number of directories read in advance of the
+// emission in ordered mode, per worker
+var aheadPerWorker = 16
+
+// parallelWalk sends folder content while reading several directories at once.
+// At most f.options.Workers directories are processed simultaneously.
+func (f *Folder) parallelWalk(out chan WalkItem) error {
+	info, err := os.Lstat(f.path)
+	if err != nil {
+		return f.fail(f.path, "walk", err)
+	}
+	if !info.IsDir() {
+		return f.emitFile(f.path, info, info.Mode().Type(), out)
+	}
+	p := &parallelWalker{
+		Folder: f,
+		out:    out,
+		sem:    make(chan struct{}, f.options.Workers),
+		ahead:  make(chan struct{}, f.options.Workers*aheadPerWorker),
+		stop:   make(chan struct{}),
+	}
+	root := &dirNode{path: f.path, pending: 1}
+	if f.options.Ordered {
+		return p.ordered(root)
+	}
+	return p.unordered(root)
+}
+
+type parallelWalker struct {
+	*Folder
+	out   chan WalkItem
+	sem   chan struct{} // ordered mode: limits the number of directories read at once
+	ahead chan struct{} // ordered mode: limits the number of directories read in advance
+	wg    sync.WaitGroup
+	once  sync.Once
+	err   error         // error that has aborted the walk
+	stop  chan struct{} // closed when the walk is aborted
+}
+
+// abort records the error that stops the walk
+func (p *parallelWalker) abort(err error) {
+	p.once.Do(func() {
+		p.err = err
+		close(p.stop)
+	})
+}
+
+func (p *parallelWalker) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// dirQueue holds the directories to be read in unordered mode. The last
+// directory found is read first, to keep the queue short.
+type dirQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	dirs    []*dirNode
+	pending int // directories queued or being read
+}
+
+func newDirQueue() *dirQueue {
+	q := &dirQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *dirQueue) push(n *dirNode) {
+	q.mu.Lock()
+	q.dirs = append(q.dirs, n)
+	q.pending++
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop waits for a directory to read. It returns nil once all directories
+// have been read.
+func (q *dirQueue) pop() *dirNode {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.dirs) == 0 && q.pending > 0 {
+		q.cond.Wait()
+	}
+	if len(q.dirs) == 0 {
+		return nil
+	}
+	n := q.dirs[len(q.dirs)-1]
+	q.dirs = q.dirs[:len(q.dirs)-1]
+	return n
+}
+
+// done tells that a directory popped has been read
+func (q *dirQueue) done() {
+	q.mu.Lock()
+	q.pending--
+	if q.pending == 0 {
+		q.cond.Broadcast()
+	}
+	q.mu.Unlock()
+}
+
+// unordered emits items as soon as directories are read. Workers pull
+// directories from the queue, and push the sub directories they find.
+func (p *parallelWalker) unordered(root *dirNode) error {
+	q := newDirQueue()
+	q.push(root)
+	for i := 0; i < p.options.Workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for n := q.pop(); n != nil; n = q.pop() {
+				p.read(n, q)
+				q.done()
+			}
+		}()
+	}
+	p.wg.Wait()
+	return p.err
+}
+
+// read emits the content of the directory, and queues its sub directories
+func (p *parallelWalker) read(n *dirNode, q *dirQueue) {
+	if p.stopped() {
+		return
+	}
+	entries, err := os.ReadDir(n.path)
+	if err != nil {
+		if err = p.fail(n.path, "read dir", err); err != nil {
+			p.abort(err)
+			return
+		}
+	}
+	for _, e := range entries {
+		if p.stopped() {
+			return
+		}
+		path := filepath.Join(n.path, e.Name())
+		info := &entryInfo{DirEntry: e, path: path}
+		if e.IsDir() {
+			child := &dirNode{path: path, parent: n, pending: 1, item: &Item{FileInfo: info, path: path}}
+			switch p.options.DirMode {
+			case DirsPreOrder:
+				p.out <- child.item
+			case DirsPostOrder:
+				atomic.AddInt32(&n.pending, 1)
+			}
+			q.push(child)
+			continue
+		}
+		if err := p.emitFile(path, info, e.Type(), p.out); err != nil {
+			p.abort(err)
+			return
+		}
+	}
+	if p.options.DirMode == DirsPostOrder {
+		p.release(n)
+	}
+}
+
+// release emits the directory once its whole subtree has been emitted
+func (p *parallelWalker) release(n *dirNode) {
+	for ; n != nil && atomic.AddInt32(&n.pending, -1) == 0; n = n.parent {
+		if n.item != nil && !p.stopped() {
+			p.out <- n.item
+		}
+	}
+}
+
+// ordered emits items in the same order as filepath.Walk. Directories are
+// read in advance by background goroutines, up to the ahead limit. Beyond,
+// they are read by the emitter when it reaches them.
+func (p *parallelWalker) ordered(root *dirNode) error {
+	atomic.StoreInt32(&root.scheduled, 2)
+	err := p.emitDir(root)
+	p.abort(err)
+	p.wg.Wait()
+	return err
+}
+
+// prefetch starts reading the directory in background. It returns false
+// when too many directories are already read in advance.
+func (p *parallelWalker) prefetch(n *dirNode) bool {
+	if atomic.LoadInt32(&n.scheduled) != 0 {
+		return true
+	}
+	select {
+	case p.ahead <- struct{}{}:
+	default:
+		return false
+	}
+	if !atomic.CompareAndSwapInt32(&n.scheduled, 0, 1) {
+		<-p.ahead
+		return true
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.load(n)
+	}()
+	return true
+}
+
+// load reads the directory once, and prefetches its sub directories
+func (p *parallelWalker) load(n *dirNode) {
+	n.once.Do(func() {
+		p.sem <- struct{}{}
+		if !p.stopped() {
+			n.entries, n.err = os.ReadDir(n.path)
+		}
+		<-p.sem
+		for _, e := range n.entries {
+			if e.IsDir() {
+				path := filepath.Join(n.path, e.Name())
+				n.children = append(n.children, &dirNode{path: path, parent: n, item: &Item{FileInfo: &entryInfo{DirEntry: e, path: path}, path: path}})
+			}
+		}
+		p.prefetchChildren(n)
+	})
+}
+
+// prefetchChildren prefetches sub directories of n, in emission order
+func (p *parallelWalker) prefetchChildren(n *dirNode) {
+	for n.next < len(n.children) && p.prefetch(n.children[n.next]) {
+		n.next++
+	}
+}
+
+func (p *parallelWalker) emitDir(n *dirNode) error {
+	atomic.CompareAndSwapInt32(&n.scheduled, 0, 2)
+	p.load(n)
+	defer func() {
+		if atomic.LoadInt32(&n.scheduled) == 1 {
+			<-p.ahead
+		}
+		n.entries, n.children = nil, nil
+	}()
+	if n.err != nil {
+		if err := p.fail(n.path, "read dir", n.err); err != nil {
+			return err
+		}
+	}
+	children := n.children
+	for _, e := range n.entries {
+		if !e.IsDir() {
+			path := filepath.Join(n.path, e.Name())
+			if err := p.emitFile(path, &entryInfo{DirEntry: e, path: path}, e.Type(), p.out); err != nil {
+				return err
+			}
+			continue
+		}
+		child := children[0]
+		children = children[1:]
+		p.prefetchChildren(n)
+		if p.options.DirMode == DirsPreOrder {
+			p.out <- child.item
+		}
+		if err := p.emitDir(child); err != nil {
+			return err
+		}
+		if p.options.DirMode == DirsPostOrder {
+			p.out <- child.item
+		}
+	}
+	return nil
+}
+
+// entryInfo implements os.FileInfo on top of os.DirEntry. The file is
+// stat'ed only when size, mode or time are requested.
+type entryInfo struct {
+	os.DirEntry
+	path string
+	once sync.Once
+	info os.FileInfo
+}
+
+func (e *entryInfo) stat() os.FileInfo {
+	e.once.Do(func() {
+		info, err := e.DirEntry.Info()
+		if err != nil {
+			// The file has vanished since the directory was read
+			info = missingInfo{e.DirEntry}
+		}
+		e.info = info
+	})
+	return e.info
+}
+
+func (e *entryInfo) Size() int64        { return e.stat().Size() }
+func (e *entryInfo) Mode() os.FileMode  { return e.stat().Mode() }
+func (e *entryInfo) ModTime() time.Time { return e.stat().ModTime() }
+func (e *entryInfo) Sys() interface{}   { return e.stat().Sys() }
+
+// missingInfo gives what is known from a directory entry
+type missingInfo struct {
+	os.DirEntry
+}
+
+func (m missingInfo) Size() int64        { return 0 }
+func (m missingInfo) Mode() os.FileMode  { return m.Type() }
+func (m missingInfo) ModTime() time.Time { return time.Time{} }
+func (m missingInfo) Sys() interface{}   { return nil }
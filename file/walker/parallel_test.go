@@ -0,0 +1,207 @@
+package walker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// makeTree creates a tree of depth levels, each directory having width files and sub directories
+func makeTree(t testing.TB, dir string, depth, width int) {
+	for i := 0; i < width; i++ {
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file_%d.txt", i)), []byte(fmt.Sprintf("file_%d.txt\n", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if depth > 0 {
+			sub := filepath.Join(dir, fmt.Sprintf("dir_%d", i))
+			if err := os.Mkdir(sub, 0755); err != nil {
+				t.Fatal(err)
+			}
+			makeTree(t, sub, depth-1, width)
+		}
+	}
+}
+
+func walkNames(t *testing.T, path string, opts ...Option) []string {
+	folder, err := Open(path, opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	names := []string{}
+	for item := range folder.Items() {
+		name := item.FullName()
+		if item.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+		item.Close()
+	}
+	folder.Close()
+	if folder.Err() != nil {
+		t.Errorf("Unexpected error %s", folder.Err())
+	}
+	return names
+}
+
+func TestParallelFolder(t *testing.T) {
+	dir := t.TempDir()
+	makeTree(t, dir, 3, 4)
+
+	for _, path := range []string{"test/tree", dir, "test/flat/file_a.txt"} {
+		for _, mode := range []DirMode{NoDirs, DirsPreOrder, DirsPostOrder} {
+			t.Run(fmt.Sprintf("%s/%d", filepath.Base(path), mode), func(t *testing.T) {
+				expected := walkNames(t, path, Dirs(mode))
+
+				got := walkNames(t, path, Dirs(mode), Workers(4), Ordered())
+				if !reflect.DeepEqual(got, expected) {
+					t.Errorf("Ordered walk, expecting\n%#q\nbut got\n%#q", expected, got)
+				}
+
+				got = walkNames(t, path, Dirs(mode), Workers(4))
+				if mode == DirsPostOrder {
+					checkPostOrder(t, got)
+				}
+				sort.Strings(got)
+				sort.Strings(expected)
+				if !reflect.DeepEqual(got, expected) {
+					t.Errorf("Unordered walk, expecting\n%#q\nbut got\n%#q", expected, got)
+				}
+			})
+		}
+	}
+}
+
+// checkPostOrder verifies that no item is emitted after its parent directory
+func checkPostOrder(t *testing.T, names []string) {
+	seen := map[string]bool{}
+	for _, name := range names {
+		for dir := filepath.Dir(filepath.Clean(name)); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+			if seen[dir+"/"] {
+				t.Errorf("'%s' emitted after its parent directory", name)
+			}
+		}
+		seen[name] = true
+	}
+}
+
+func TestParallelFolderItems(t *testing.T) {
+	folder, err := Open("test/tree", Workers(3))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	for item := range folder.Items() {
+		if item.Size() != int64(len(item.Name())+1) {
+			t.Errorf("Expected size of '%s' to be %d, but got %d", item.Name(), len(item.Name())+1, item.Size())
+		}
+		reader, err := item.Reader()
+		if err != nil {
+			t.Errorf("Unexpected error when opening '%s'", item.FullName())
+			continue
+		}
+		content, _ := ioutil.ReadAll(reader)
+		if string(content) != item.Name()+"\n" {
+			t.Errorf("Expected content of '%s' file to by '%s', but got '%s'!", item.Name(), item.Name(), content)
+		}
+		item.Close()
+	}
+	folder.Close()
+}
+
+func TestParallelFolderAhead(t *testing.T) {
+	dir := t.TempDir()
+	makeTree(t, dir, 3, 4)
+	defer func(n int) { aheadPerWorker = n }(aheadPerWorker)
+	expected := walkNames(t, dir, Dirs(DirsPreOrder))
+	for _, n := range []int{0, 1, 2} {
+		aheadPerWorker = n
+		got := walkNames(t, dir, Dirs(DirsPreOrder), Workers(2), Ordered())
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("With %d directories ahead per worker, expecting\n%#q\nbut got\n%#q", n, expected, got)
+		}
+	}
+}
+
+func TestParallelFolderWorkers(t *testing.T) {
+	dir := t.TempDir()
+	makeTree(t, dir, 1, 16)
+	before := runtime.NumGoroutine()
+	folder, err := Open(dir, Workers(2))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	items := folder.Items()
+	item := <-items
+	item.Close()
+	time.Sleep(20 * time.Millisecond)
+	// The walk goroutine and the workers, all blocked on the channel
+	if n := runtime.NumGoroutine() - before; n > 3 {
+		t.Errorf("Expected at most 3 goroutines for 2 workers, but got %d", n)
+	}
+	for item := range items {
+		item.Close()
+	}
+	folder.Close()
+}
+
+func TestParallelFolderErrors(t *testing.T) {
+	dir := t.TempDir()
+	makeTree(t, dir, 2, 4)
+	broken := 0
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			broken++
+			return os.Symlink(filepath.Join(path, "nowhere"), filepath.Join(path, "broken.txt"))
+		}
+		return err
+	})
+	for _, ordered := range []bool{false, true} {
+		opts := []Option{Workers(8)}
+		if ordered {
+			opts = append(opts, Ordered())
+		}
+		var inside int32
+		reported := []string{}
+		folder, err := Open(dir, append(opts, OnError(func(err error) error {
+			if atomic.AddInt32(&inside, 1) > 1 {
+				t.Error("Error handler called concurrently")
+			}
+			reported = append(reported, err.(*Error).Path)
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&inside, -1)
+			return nil
+		}))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for item := range folder.Items() {
+			item.Close()
+		}
+		folder.Close()
+		if len(reported) != broken {
+			t.Errorf("Expecting %d errors, but got %d", broken, len(reported))
+		}
+	}
+}
+
+func BenchmarkFolder(b *testing.B) {
+	dir := b.TempDir()
+	makeTree(b, dir, 3, 8)
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers_%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				folder, _ := Open(dir, Workers(workers))
+				for item := range folder.Items() {
+					item.Close()
+				}
+				folder.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package walker
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// OpenPath gives the item designated by a path that may traverse an archive,
+// like "a.zip/dir/file.txt", or nested archives, like "a.zip/b.zip/file.txt".
+// The longest part of the path existing on disk is open with the walker of its
+// detected format, and the remaining is looked up into it.
+// Closing the returned item closes the archive as well.
+func OpenPath(path string, opts ...Option) (WalkItem, error) {
+	path = filepath.Clean(path)
+	container := path
+	for {
+		info, err := os.Stat(container)
+		if err == nil {
+			if container == path {
+				return &Item{FileInfo: info, path: path}, nil
+			}
+			if info.IsDir() {
+				return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+			}
+			break
+		}
+		parent := filepath.Dir(container)
+		if parent == container {
+			return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+		}
+		container = parent
+	}
+
+	member := filepath.ToSlash(path[len(container)+1:])
+	item, closers, err := lookupMember(container, member, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &pathItem{WalkItem: item, path: path, closers: closers}, nil
+}
+
+// lookupMember gives the member of the archive at container. Members of nested
+// archives, like "b.zip/file.txt", are reached by extracting the nested archive
+// into a temporary file. Closers release walkers and temporary files.
+func lookupMember(container, member string, opts []Option) (WalkItem, []func(), error) {
+	o := NewOptions(opts...)
+	closers := []func(){}
+	fail := func(err error) (WalkItem, []func(), error) {
+		closeAll(closers)
+		return nil, nil, err
+	}
+	for {
+		d, ok := detectContainer(container, o)
+		if !ok {
+			return fail(&os.PathError{Op: "open", Path: container, Err: ErrWalkerNotFound})
+		}
+		w, err := d.Opener(container, opts...)
+		if err != nil {
+			return fail(err)
+		}
+		closers = append(closers, w.Close)
+		finder, ok := w.(Finder)
+		if !ok {
+			return fail(&os.PathError{Op: "lookup", Path: container, Err: ErrWalkerNotFound})
+		}
+		item, err := finder.Lookup(member)
+		if err == nil {
+			return item, closers, nil
+		}
+		nested, rest := nestedArchive(finder, member)
+		if nested == "" {
+			return fail(err)
+		}
+		dir, err := extract(finder, nested, o.SpoolLimit)
+		if err != nil {
+			return fail(err)
+		}
+		closers = append(closers, func() { os.RemoveAll(dir) })
+		container, member = filepath.Join(dir, path.Base(nested)), rest
+	}
+}
+
+// nestedArchive splits the member name into the longest leading part that is
+// a file of the archive, and the rest. It gives empty strings when no such
+// part exists.
+func nestedArchive(finder Finder, member string) (string, string) {
+	parts := strings.Split(member, "/")
+	for i := len(parts) - 1; i > 0; i-- {
+		name := strings.Join(parts[:i], "/")
+		if info, err := finder.Stat(name); err == nil && !info.IsDir() {
+			return name, strings.Join(parts[i:], "/")
+		}
+	}
+	return "", ""
+}
+
+// extract copies the member into a temporary directory, under its base name
+// for its format to be detected. It fails with ErrTooLarge when the member
+// exceeds limit bytes.
+func extract(finder Finder, name string, limit int64) (string, error) {
+	item, err := finder.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	defer item.Close()
+	r, err := item.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	dir, err := ioutil.TempDir("", "walker-nested-")
+	if err != nil {
+		return "", errors.Wrap(err, "Can't extract nested archive")
+	}
+	f, err := os.Create(filepath.Join(dir, path.Base(name)))
+	if err == nil {
+		var n int64
+		n, err = io.Copy(f, io.LimitReader(r, limit+1))
+		if err == nil && n > limit {
+			err = ErrTooLarge
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", errors.Wrapf(err, "Can't extract nested archive '%s'", name)
+	}
+	return dir, nil
+}
+
+func closeAll(closers []func()) {
+	for i := len(closers) - 1; i >= 0; i-- {
+		closers[i]()
+	}
+}
+
+// pathItem closes the walkers of the item with the item. Its full name is
+// the path given to OpenPath.
+type pathItem struct {
+	WalkItem
+	path        string
+	closers     []func()
+	once        sync.Once
+	contentType contentTypeCache // Content type given by ContentType
+}
+
+// contentTypes gives the content type kept by the item
+func (i *pathItem) contentTypes() *contentTypeCache {
+	return &i.contentType
+}
+
+// FullName gives the path given to OpenPath
+func (i *pathItem) FullName() string {
+	return i.path
+}
+
+// String gives the path given to OpenPath
+func (i *pathItem) String() string {
+	return i.path
+}
+
+// Close closes the item and its walkers. Closing twice is harmless.
+func (i *pathItem) Close() {
+	i.once.Do(func() {
+		i.WalkItem.Close()
+		closeAll(i.closers)
+	})
+}
@@ -0,0 +1,205 @@
+// Package rarwalker walks through RAR archives. RAR archives are read only.
+package rarwalker
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nwaples/rardecode/v2"
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/walker"
+)
+
+// init registers RAR walker into walkers.
+func init() {
+	walker.RegisterFormat(walker.Format{
+		Name:     "rar",
+		Opener:   Open,
+		Matcher:  Matcher,
+		Detector: Detector,
+	})
+}
+
+// Matcher returns true when the name is like .rar. Used to recognize
+// the kind of Walker to be open.
+func Matcher(name string) bool {
+	return strings.ToLower(filepath.Ext(name)) == ".rar"
+}
+
+// Detector returns true when the header starts with the rar signature.
+var Detector = walker.Magic(0, "Rar!\x1a\x07")
+
+// peekLen is the length of content read to check the password of encrypted members
+const peekLen = 512
+
+// Rar handles RAR archive as a Walker. Archive volumes are opened by
+// member readers, the walker itself doesn't keep them open.
+type Rar struct {
+	*walker.Archive
+	path    string
+	keyring *walker.Keyring
+	solid   walker.Streams // decoder of solid members
+	listsMu sync.Mutex
+	lists   map[string][]*rardecode.File // archive members by password
+}
+
+// Open opens a RAR archive at path. Archives with encrypted headers are opened
+// with the first candidate password that fits.
+func Open(path string, opts ...walker.Option) (walker.Walker, error) {
+	options := walker.NewOptions(opts...)
+	r := &Rar{
+		path:    path,
+		keyring: walker.NewKeyring(path, options, ""),
+		lists:   map[string][]*rardecode.File{},
+	}
+	var (
+		files []*rardecode.File
+		err   error
+	)
+	for _, password := range r.keyring.Candidates() {
+		files, err = r.list(password)
+		if err == nil {
+			r.keyring.Promote(password)
+			break
+		}
+	}
+	if errors.Is(err, rardecode.ErrArchiveEncrypted) || errors.Is(err, rardecode.ErrBadPassword) {
+		err = walker.ErrPassword
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't open RAR")
+	}
+	members := []*walker.Member{}
+	for n, f := range files {
+		name := walker.CleanName(f.Name, f.IsDir)
+		if name == "" {
+			continue
+		}
+		members = append(members, &walker.Member{Name: name, Info: fileInfo{&files[n].FileHeader}, Header: &files[n].FileHeader, Index: n})
+	}
+	r.Archive = walker.NewArchive(path, members, r, r.solid.Close, options)
+	return r, nil
+}
+
+// decodeOptions gives the options of the password. The empty password
+// leaves encrypted members undecoded, instead of failing at their check.
+func decodeOptions(password string) []rardecode.Option {
+	if password == "" {
+		return nil
+	}
+	return []rardecode.Option{rardecode.Password(password)}
+}
+
+// list gives archive members, using the password
+func (r *Rar) list(password string) ([]*rardecode.File, error) {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+	if files, ok := r.lists[password]; ok {
+		return files, nil
+	}
+	files, err := rardecode.List(r.path, decodeOptions(password)...)
+	if err != nil {
+		return nil, err
+	}
+	r.lists[password] = files
+	return files, nil
+}
+
+// encrypted tells if the error may come from a missing or wrong password
+func encrypted(m *walker.Member, err error) bool {
+	return m.Header.(*rardecode.FileHeader).Encrypted ||
+		errors.Is(err, rardecode.ErrArchivedFileEncrypted) ||
+		errors.Is(err, rardecode.ErrBadPassword)
+}
+
+// solidStream reads the members of a solid archive in order
+type solidStream struct {
+	*rardecode.ReadCloser
+}
+
+func (s solidStream) Next() error {
+	_, err := s.ReadCloser.Next()
+	return err
+}
+
+// openFile opens the member. Members of solid archives are decoded after
+// the preceding ones: the decoder of the last member read is reused when
+// members are opened in the archive order.
+func (r *Rar) openFile(m *walker.Member, password string) (io.ReadCloser, error) {
+	files, err := r.list(password)
+	if err != nil {
+		return nil, err
+	}
+	if !m.Header.(*rardecode.FileHeader).Solid {
+		return files[m.Index].Open()
+	}
+	return r.solid.Open(m.Index, password, func() (walker.Stream, error) {
+		rc, err := rardecode.OpenReader(r.path, decodeOptions(password)...)
+		if err != nil {
+			return nil, err
+		}
+		return solidStream{rc}, nil
+	})
+}
+
+// OpenMember gives a reader on the member content. The first bytes are read
+// to check the password of encrypted members: candidate passwords are tried
+// until the content can be decoded. A wrong password that isn't detected
+// then gives a checksum error at the end of the content.
+// implements walker.MemberOpener
+func (r *Rar) OpenMember(m *walker.Member, path string) (io.ReadCloser, error) {
+	var err error
+	for _, password := range r.keyring.Candidates() {
+		var rc io.ReadCloser
+		rc, err = r.openFile(m, password)
+		if err != nil {
+			if encrypted(m, err) {
+				continue
+			}
+			return nil, err
+		}
+		peek := make([]byte, peekLen)
+		var l int
+		l, err = io.ReadFull(rc, peek)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			rc.Close()
+			if encrypted(m, err) {
+				continue
+			}
+			return nil, err
+		}
+		r.keyring.Promote(password)
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(peek[:l]), rc), rc}, nil
+	}
+	return nil, &walker.Error{Path: path, Op: "decrypt", Err: walker.ErrPassword}
+}
+
+// MemberMeta gives the archive member packed size and encryption
+// implements walker.MemberOpener
+func (r *Rar) MemberMeta(m *walker.Member) walker.Meta {
+	h := m.Header.(*rardecode.FileHeader)
+	return walker.Meta{
+		walker.MetaCompressedSize: uint64(h.PackedSize),
+		walker.MetaEncrypted:      h.Encrypted,
+	}
+}
+
+// fileInfo implements os.FileInfo on top of the member header
+type fileInfo struct {
+	h *rardecode.FileHeader
+}
+
+func (f fileInfo) Name() string       { return filepath.Base(f.h.Name) }
+func (f fileInfo) Size() int64        { return f.h.UnPackedSize }
+func (f fileInfo) Mode() os.FileMode  { return f.h.Mode() }
+func (f fileInfo) ModTime() time.Time { return f.h.ModificationTime }
+func (f fileInfo) IsDir() bool        { return f.h.IsDir }
+func (f fileInfo) Sys() interface{}   { return f.h }
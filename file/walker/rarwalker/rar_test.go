@@ -0,0 +1,335 @@
+package rarwalker
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simulot/golib/file/walker"
+)
+
+// test/sample.rar holds asd.go, a small Go program. It comes from the
+// testdata of github.com/gabriel-vasile/mimetype (MIT license). Other
+// archives are written by writeRAR.
+const sampleStart = "package main\n"
+
+func TestRarItems(t *testing.T) {
+	w, err := Open("test/sample.rar")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	got := []string{}
+	for item := range w.Items() {
+		got = append(got, filepath.ToSlash(item.FullName()))
+		r, err := item.RawReader()
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil || int64(len(b)) != item.Size() || !strings.HasPrefix(string(b), sampleStart) {
+			t.Errorf("Unexpected content for '%s': %q, %v", item.Name(), b, err)
+		}
+		if encrypted := item.Meta()[walker.MetaEncrypted]; encrypted != false {
+			t.Errorf("Expected member to be not encrypted, but got %v", encrypted)
+		}
+		item.Close()
+	}
+	expected := []string{"test/sample.rar/asd.go"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %#q, but got %#q", expected, got)
+	}
+	if err = w.(*Rar).CloseWait(context.Background()); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+}
+
+func TestRarLookup(t *testing.T) {
+	w, err := Open("test/sample.rar", walker.LeakDetection())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	z := w.(walker.Finder)
+	item, err := z.Lookup("/asd.go")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	r, err := item.(walker.RandomAccess).OpenRandom()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	b := make([]byte, len(sampleStart))
+	if _, err = r.ReadAt(b, 0); err != nil || string(b) != sampleStart {
+		t.Errorf("Expected %q, but got %q, %v", sampleStart, b, err)
+	}
+	r.Close()
+	item.Close()
+	if _, err := z.Lookup("file_z.txt"); !os.IsNotExist(err) {
+		t.Errorf("Expected not exist error, but got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = w.(*Rar).CloseWait(ctx); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+}
+
+// rarFile is a member written by writeRAR. Directory names end with a slash.
+type rarFile struct {
+	name    string
+	content string
+}
+
+// writeRAR writes a RAR5 archive with stored members. Members are flagged
+// solid when the archive is, and are encrypted with AES-256 when a password
+// is given.
+func writeRAR(t *testing.T, files []rarFile, solid bool, password string) string {
+	b := []byte("Rar!\x1a\x07\x01\x00")
+	var flags uint64
+	if solid {
+		flags = 0x0004
+	}
+	b = append(b, rarBlock(1, nil, 0, vint(nil, flags))...)
+	for n, f := range files {
+		dir := strings.HasSuffix(f.name, "/")
+		data := []byte(f.content)
+		fileFlags, attributes := uint64(0x0002|0x0004), uint64(0100644)
+		if dir {
+			fileFlags, attributes = 0x0001|0x0002, 040755
+		}
+		h := vint(nil, fileFlags)
+		h = vint(h, uint64(len(data)))
+		h = vint(h, attributes)
+		h = binary.LittleEndian.AppendUint32(h, 1600000000)
+		if !dir {
+			h = binary.LittleEndian.AppendUint32(h, crc32.ChecksumIEEE(data))
+		}
+		var compression uint64
+		if solid && n > 0 {
+			compression = 0x40 // the member depends on preceding ones
+		}
+		h = vint(h, compression)
+		h = vint(h, 1) // unix
+		name := strings.TrimSuffix(f.name, "/")
+		h = vint(h, uint64(len(name)))
+		h = append(h, name...)
+		var extra []byte
+		if password != "" && !dir {
+			extra, data = rarEncrypt(t, data, password, byte(n))
+		}
+		b = append(b, rarBlock(2, extra, len(data), h)...)
+		b = append(b, data...)
+	}
+	b = append(b, rarBlock(5, nil, 0, vint(nil, 0))...)
+	path := filepath.Join(t.TempDir(), "archive.rar")
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// rarBlock encodes a block header of the given type
+func rarBlock(kind uint64, extra []byte, dataLen int, fields []byte) []byte {
+	var flags uint64
+	if extra != nil {
+		flags |= 0x0001
+	}
+	if dataLen > 0 {
+		flags |= 0x0002
+	}
+	h := vint(nil, kind)
+	h = vint(h, flags)
+	if extra != nil {
+		h = vint(h, uint64(len(extra)))
+	}
+	if dataLen > 0 {
+		h = vint(h, uint64(dataLen))
+	}
+	h = append(append(h, fields...), extra...)
+	h = append(vint(nil, uint64(len(h))), h...)
+	return append(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(h)), h...)
+}
+
+// vint appends the RAR5 variable length integer
+func vint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// rarEncrypt gives the encryption record of the member, and its encrypted data
+func rarEncrypt(t *testing.T, data []byte, password string, seed byte) ([]byte, []byte) {
+	const kdfCount = 4
+	salt := bytes.Repeat([]byte{seed + 1}, 16)
+	iv := bytes.Repeat([]byte{seed + 2}, 16)
+
+	// PBKDF2-HMAC-SHA256, continued to derive the password check value
+	prf := hmac.New(sha256.New, []byte(password))
+	prf.Write(salt)
+	prf.Write([]byte{0, 0, 0, 1})
+	sum := prf.Sum(nil)
+	u := append([]byte{}, sum...)
+	keys := [][]byte{}
+	for _, iterations := range []int{1<<kdfCount - 1, 16, 16} {
+		for ; iterations > 0; iterations-- {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range u {
+				sum[j] ^= u[j]
+			}
+		}
+		keys = append(keys, append([]byte{}, sum...))
+	}
+	check := make([]byte, 8)
+	for i, v := range keys[2] {
+		check[i%8] ^= v
+	}
+	checkSum := sha256.Sum256(check)
+
+	record := vint(nil, 1) // encryption
+	record = vint(record, 0)
+	record = vint(record, 0x0001) // password check present
+	record = append(record, kdfCount)
+	record = append(append(append(record, salt...), iv...), check...)
+	record = append(record, checkSum[:4]...)
+
+	block, err := aes.NewCipher(keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	padded := append([]byte{}, data...)
+	padded = append(padded, make([]byte, (aes.BlockSize-len(data)%aes.BlockSize)%aes.BlockSize)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+	return append(vint(nil, uint64(len(record))), record...), padded
+}
+
+var generated = []rarFile{
+	{"dir/", ""},
+	{"dir/file_a.txt", "file_a.txt\n"},
+	{"dir/sub/file_b.txt", "file_b.txt\n"},
+	{"file_c.txt", "file_c.txt\n"},
+}
+
+// readAll gives the names and contents of walked items
+func readAll(t *testing.T, w walker.Walker) []string {
+	got := []string{}
+	for item := range w.Items() {
+		name := filepath.ToSlash(item.MemberName())
+		if item.IsDir() {
+			got = append(got, name+"/")
+			item.Close()
+			continue
+		}
+		r, err := item.RawReader()
+		if err != nil {
+			t.Fatalf("Unexpected error %s for '%s'", err, name)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("Unexpected error %s for '%s'", err, name)
+		}
+		got = append(got, name+"="+string(b))
+		item.Close()
+	}
+	return got
+}
+
+func TestRarSolid(t *testing.T) {
+	path := writeRAR(t, generated, true, "")
+	w, err := Open(path, walker.Dirs(walker.NoDirs))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	expected := []string{"/dir/file_a.txt=file_a.txt\n", "/dir/sub/file_b.txt=file_b.txt\n", "/file_c.txt=file_c.txt\n"}
+	if got := readAll(t, w); !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %q, but got %q", expected, got)
+	}
+
+	// Members open out of order are decoded again
+	item, err := w.(walker.Finder).Lookup("dir/file_a.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	r, _ := item.RawReader()
+	if b, err := ioutil.ReadAll(r); err != nil || string(b) != "file_a.txt\n" {
+		t.Errorf("Expected 'file_a.txt', but got %q, %v", b, err)
+	}
+	item.Close()
+	if err = w.(*Rar).CloseWait(context.Background()); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+}
+
+func TestRarEncrypted(t *testing.T) {
+	path := writeRAR(t, generated, false, "secret")
+	for _, c := range []struct {
+		passwords []string
+		err       error
+	}{
+		{[]string{"wrong", "secret"}, nil},
+		{[]string{"wrong"}, walker.ErrPassword},
+		{nil, walker.ErrPassword},
+	} {
+		w, err := Open(path, walker.Dirs(walker.NoDirs), walker.Passwords(c.passwords...))
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		for item := range w.Items() {
+			if encrypted := item.Meta()[walker.MetaEncrypted]; encrypted != true {
+				t.Errorf("Expected '%s' to be encrypted, but got %v", item.Name(), encrypted)
+			}
+			r, err := item.RawReader()
+			if c.err != nil {
+				if e, ok := err.(*walker.Error); !ok || e.Err != c.err {
+					t.Errorf("Expected error %v for '%s', but got %v", c.err, item.Name(), err)
+				}
+				item.Close()
+				continue
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if b, err := ioutil.ReadAll(r); err != nil || string(b) != item.Name()+"\n" {
+				t.Errorf("Expected content of '%s', but got %q, %v", item.Name(), b, err)
+			}
+			item.Close()
+		}
+		w.Close()
+	}
+}
+
+func TestRarDirModes(t *testing.T) {
+	path := writeRAR(t, generated, false, "")
+	cases := []struct {
+		mode     walker.DirMode
+		expected []string
+	}{
+		{walker.DirsPreOrder, []string{"/dir/", "/dir/file_a.txt=file_a.txt\n", "/dir/sub/", "/dir/sub/file_b.txt=file_b.txt\n", "/file_c.txt=file_c.txt\n"}},
+		{walker.DirsPostOrder, []string{"/dir/file_a.txt=file_a.txt\n", "/dir/sub/file_b.txt=file_b.txt\n", "/dir/sub/", "/dir/", "/file_c.txt=file_c.txt\n"}},
+	}
+	for _, c := range cases {
+		w, err := Open(path, walker.Dirs(c.mode))
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if got := readAll(t, w); !reflect.DeepEqual(c.expected, got) {
+			t.Errorf("Expected %q, but got %q", c.expected, got)
+		}
+		w.Close()
+	}
+}
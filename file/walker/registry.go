@@ -0,0 +1,86 @@
+package walker
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry holds container formats walkers descend into. It is safe for
+// concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	formats []Format // sorted by descending priority, then registration order
+}
+
+// DefaultRegistry is used by walkers unless the UseRegistry option is given.
+// Concrete walkers register their formats into it.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry gives an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds the format to the registry. A named format replaces the
+// registered one of same name. Formats of same priority are tried in
+// registration order.
+func (r *Registry) Register(f Format) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f.Name != "" {
+		r.remove(f.Name)
+	}
+	i := sort.Search(len(r.formats), func(i int) bool {
+		return r.formats[i].Priority < f.Priority
+	})
+	r.formats = append(r.formats, Format{})
+	copy(r.formats[i+1:], r.formats[i:])
+	r.formats[i] = f
+}
+
+// Unregister removes the named format. It returns false when the format
+// isn't registered.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remove(name)
+}
+
+func (r *Registry) remove(name string) bool {
+	for i, f := range r.formats {
+		if f.Name == name {
+			r.formats = append(r.formats[:i:i], r.formats[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup gives the named format
+func (r *Registry) Lookup(name string) (Format, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.formats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// Formats gives registered formats in the order they are tried.
+// A nil registry has no format.
+func (r *Registry) Formats() []Format {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Format{}, r.formats...)
+}
+
+// Clone gives an independent copy of the registry, to be tuned for a
+// particular walk.
+func (r *Registry) Clone() *Registry {
+	return &Registry{formats: r.Formats()}
+}
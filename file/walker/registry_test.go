@@ -0,0 +1,70 @@
+package walker
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func formatNames(r *Registry) []string {
+	names := []string{}
+	for _, f := range r.Formats() {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Register(Format{Name: "a"})
+	r.Register(Format{Name: "b", Priority: 5})
+	r.Register(Format{Name: "c"})
+	r.Register(Format{Name: "d", Priority: -1})
+	if got, expected := formatNames(r), []string{"b", "a", "c", "d"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, but got %q", expected, got)
+	}
+
+	r.Register(Format{Name: "a", Priority: 10})
+	if got, expected := formatNames(r), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q after replacement, but got %q", expected, got)
+	}
+
+	clone := r.Clone()
+	if !r.Unregister("b") {
+		t.Errorf("Expected 'b' to be unregistered")
+	}
+	if r.Unregister("b") {
+		t.Errorf("Expected 'b' to be already unregistered")
+	}
+	if _, ok := r.Lookup("b"); ok {
+		t.Errorf("Expected 'b' not to be found")
+	}
+	if f, ok := clone.Lookup("b"); !ok || f.Priority != 5 {
+		t.Errorf("Expected 'b' to be kept by the clone, but got %v, %v", f, ok)
+	}
+	if got := (*Registry)(nil).Formats(); len(got) != 0 {
+		t.Errorf("Expected no format in nil registry, but got %v", got)
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	r := NewRegistry()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("f%d", i)
+			r.Register(Format{Name: name, Priority: i % 3})
+			r.Formats()
+			if i%2 == 0 {
+				r.Unregister(name)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if got := len(r.Formats()); got != 10 {
+		t.Errorf("Expected 10 formats, but got %d", got)
+	}
+}
@@ -0,0 +1,17 @@
+#!/bin/bash
+# Test archives are made with bsdtar from walker test folders
+rm -rf test
+mkdir test
+
+pushd ../test/tree
+bsdtar --format 7zip -cf ../../sevenzipwalker/test/tree.7z *
+popd
+
+pushd ../test/flat
+bsdtar --format 7zip --options 7zip:compression=store -cf ../../sevenzipwalker/test/flat.7z *
+popd
+
+# encrypted.7z comes from the 7z reader test data: its headers and members
+# are encrypted with the password "password"
+cp "$(go env GOMODCACHE)/github.com/bodgit/sevenzip@v1.6.0/testdata/aes7z.7z" test/encrypted.7z
+chmod 644 test/encrypted.7z
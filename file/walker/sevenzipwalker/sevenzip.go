@@ -0,0 +1,164 @@
+// Package sevenzipwalker walks through 7z archives.
+package sevenzipwalker
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/walker"
+)
+
+// init registers 7z walker into walkers.
+func init() {
+	walker.RegisterFormat(walker.Format{
+		Name:     "7z",
+		Opener:   Open,
+		Matcher:  Matcher,
+		Detector: Detector,
+	})
+}
+
+// Matcher returns true when the name is like .7z. Used to recognize
+// the kind of Walker to be open.
+func Matcher(name string) bool {
+	return strings.ToLower(filepath.Ext(name)) == ".7z"
+}
+
+// Detector returns true when the header starts with the 7z signature.
+var Detector = walker.Magic(0, "7z\xbc\xaf\x27\x1c")
+
+// peekLen is the length of content read to check the password of encrypted members
+const peekLen = 512
+
+// SevenZip handles 7z archive as a Walker.
+type SevenZip struct {
+	*walker.Archive
+	file    *os.File // archive file
+	size    int64    // archive size
+	keyring *walker.Keyring
+
+	readersMu sync.Mutex
+	readers   map[string]*sevenzip.Reader // archive readers by password
+}
+
+// Open opens a 7z archive at path. Archives with encrypted headers are opened
+// with the first candidate password that fits.
+func Open(path string, opts ...walker.Option) (walker.Walker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't open 7z")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "Can't open 7z")
+	}
+	options := walker.NewOptions(opts...)
+	z := &SevenZip{
+		file:    file,
+		size:    info.Size(),
+		keyring: walker.NewKeyring(path, options, ""),
+		readers: map[string]*sevenzip.Reader{},
+	}
+	var archive *sevenzip.Reader
+	for _, password := range z.keyring.Candidates() {
+		archive, err = z.reader(password)
+		if err == nil {
+			z.keyring.Promote(password)
+			break
+		}
+	}
+	if encrypted(err) {
+		err = walker.ErrPassword
+	}
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "Can't open 7z")
+	}
+	members := []*walker.Member{}
+	for n, f := range archive.File {
+		name := walker.CleanName(f.Name, f.FileInfo().IsDir())
+		if name == "" {
+			continue
+		}
+		members = append(members, &walker.Member{Name: name, Info: f.FileInfo(), Header: &archive.File[n].FileHeader, Index: n})
+	}
+	z.Archive = walker.NewArchive(path, members, z, file.Close, options)
+	return z, nil
+}
+
+// reader gives the archive reader using the password
+func (z *SevenZip) reader(password string) (*sevenzip.Reader, error) {
+	z.readersMu.Lock()
+	defer z.readersMu.Unlock()
+	if r, ok := z.readers[password]; ok {
+		return r, nil
+	}
+	r, err := sevenzip.NewReaderWithPassword(z.file, z.size, password)
+	if err != nil {
+		return nil, err
+	}
+	z.readers[password] = r
+	return r, nil
+}
+
+// encrypted tells if the error may come from a missing or wrong password
+func encrypted(err error) bool {
+	var e *sevenzip.ReadError
+	return errors.As(err, &e) && e.Encrypted
+}
+
+// OpenMember gives a reader on the member content. The first bytes are read
+// to check the password of encrypted members: candidate passwords are tried
+// until the content can be decoded. A wrong password that isn't detected
+// then gives a checksum error at the end of the content.
+// implements walker.MemberOpener
+func (z *SevenZip) OpenMember(m *walker.Member, path string) (io.ReadCloser, error) {
+	var err error
+	for _, password := range z.keyring.Candidates() {
+		var archive *sevenzip.Reader
+		archive, err = z.reader(password)
+		if err != nil {
+			continue
+		}
+		var rc io.ReadCloser
+		rc, err = archive.File[m.Index].Open()
+		if err != nil {
+			if encrypted(err) {
+				continue
+			}
+			return nil, err
+		}
+		peek := make([]byte, peekLen)
+		var l int
+		l, err = io.ReadFull(rc, peek)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			rc.Close()
+			if encrypted(err) {
+				continue
+			}
+			return nil, err
+		}
+		z.keyring.Promote(password)
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(peek[:l]), rc), rc}, nil
+	}
+	if encrypted(err) {
+		return nil, &walker.Error{Path: path, Op: "decrypt", Err: walker.ErrPassword}
+	}
+	return nil, err
+}
+
+// MemberMeta gives the archive member checksum
+// implements walker.MemberOpener
+func (z *SevenZip) MemberMeta(m *walker.Member) walker.Meta {
+	return walker.Meta{walker.MetaCRC32: m.Header.(*sevenzip.FileHeader).CRC32}
+}
@@ -0,0 +1,59 @@
+package sevenzipwalker
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/walker"
+	"github.com/simulot/golib/file/walker/walkertest"
+)
+
+func TestSevenZip(t *testing.T) {
+	walkertest.Archive(t, Open,
+		walkertest.Case{Path: "test/flat.7z", Names: walkertest.FlatNames, Meta: []string{walker.MetaCRC32}},
+		walkertest.Case{Path: "test/tree.7z", Names: walkertest.TreeNames, Meta: []string{walker.MetaCRC32}},
+	)
+}
+
+func TestSevenZipEncrypted(t *testing.T) {
+	for _, c := range []struct {
+		passwords []string
+		err       error
+	}{
+		{[]string{"wrong", "password"}, nil},
+		{[]string{"wrong"}, walker.ErrPassword},
+		{nil, walker.ErrPassword},
+	} {
+		w, err := Open("test/encrypted.7z", walker.Passwords(c.passwords...))
+		if c.err != nil {
+			if errors.Cause(err) != c.err {
+				t.Errorf("Expected error %v, but got %v", c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		count := 0
+		for item := range w.Items() {
+			count++
+			if _, ok := item.Meta()[walker.MetaCRC32]; !ok {
+				t.Errorf("Expected %s in metadata of '%s', but got %v", walker.MetaCRC32, item.Name(), item.Meta())
+			}
+			r, err := item.RawReader()
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if b, err := ioutil.ReadAll(r); err != nil || !strings.HasPrefix(string(b), "Lorem ipsum") {
+				t.Errorf("Expected content of '%s', but got %.20q, %v", item.Name(), b, err)
+			}
+			item.Close()
+		}
+		w.Close()
+		if count != 10 {
+			t.Errorf("Expected 10 members, but got %d", count)
+		}
+	}
+}
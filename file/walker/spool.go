@@ -0,0 +1,43 @@
+package walker
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Spool copies the reader into a temporary file to give random access on the
+// content. It fails with ErrTooLarge when the content exceeds limit bytes.
+// The temporary file is removed when closed.
+func Spool(r io.Reader, limit int64) (ReadSeekAtCloser, error) {
+	f, err := ioutil.TempFile("", "walker-spool-")
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't create spool file")
+	}
+	s := &spoolFile{File: f}
+	n, err := io.Copy(f, io.LimitReader(r, limit+1))
+	if err == nil && n > limit {
+		err = ErrTooLarge
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		s.Close()
+		return nil, errors.Wrap(err, "Can't spool")
+	}
+	return s, nil
+}
+
+// spoolFile is a temporary file removed on close
+type spoolFile struct {
+	*os.File
+}
+
+func (s *spoolFile) Close() error {
+	err := s.File.Close()
+	os.Remove(s.Name())
+	return err
+}
@@ -0,0 +1,35 @@
+package walker
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestSpool(t *testing.T) {
+	r, err := Spool(strings.NewReader("0123456789"), 10)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	b := make([]byte, 3)
+	if _, err = r.ReadAt(b, 4); err != nil || string(b) != "456" {
+		t.Errorf("Expected '456', but got '%s', %v", b, err)
+	}
+	r.Seek(8, io.SeekStart)
+	if b, _ = ioutil.ReadAll(r); string(b) != "89" {
+		t.Errorf("Expected '89', but got '%s'", b)
+	}
+	name := r.(*spoolFile).Name()
+	r.Close()
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Expected spool file to be removed, but got %v", err)
+	}
+
+	if _, err = Spool(strings.NewReader("0123456789"), 9); errors.Cause(err) != ErrTooLarge {
+		t.Errorf("Expected ErrTooLarge, but got %v", err)
+	}
+}
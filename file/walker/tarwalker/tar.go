@@ -0,0 +1,241 @@
+package tarwalker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/walker"
+)
+
+// init registers tar walker into walkers.
+func init() {
+	walker.RegisterFormat(walker.Format{
+		Name:     "tar",
+		Opener:   Open,
+		Matcher:  Matcher,
+		Detector: Detector,
+	})
+}
+
+// Matcher returns true when the name is like .tar, .tar.gz or .tgz.
+func Matcher(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+var (
+	isTar  = walker.Magic(257, "ustar")
+	isGzip = walker.Magic(0, "\x1f\x8b")
+)
+
+// Detector returns true when the header is the one of a tar archive, or of
+// a gzipped tar archive.
+func Detector(header []byte) bool {
+	if isTar(header) {
+		return true
+	}
+	if !isGzip(header) {
+		return false
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(header))
+	if err != nil {
+		return false
+	}
+	b := make([]byte, 512)
+	n, _ := io.ReadFull(gz, b)
+	return isTar(b[:n])
+}
+
+// Tar handles tar archive as a Walker. Member contents of uncompressed
+// archives are read directly from the archive file. Members of gzipped
+// archives are decompressed from the start of the archive, or from the
+// last member read when they are opened in the archive order.
+type Tar struct {
+	*walker.Archive
+	file       *os.File       // archive file
+	size       int64          // archive size
+	gzipped    bool           // the archive is gzipped
+	sequential walker.Streams // decoder of sequential members
+}
+
+// header is the member header with the location of its content
+type header struct {
+	*tar.Header
+	offset     int64 // content offset in uncompressed archives
+	sequential bool  // content can't be read at offset
+}
+
+// Open opens a tar archive at path, gzipped or not. Headers are read at
+// once to locate member contents: the contents of uncompressed archives are
+// skipped by seeking. A damaged header ends the archive, it is reported by
+// Items.
+func Open(path string, opts ...walker.Option) (walker.Walker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't open tar")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "Can't open tar")
+	}
+	t := &Tar{
+		file: file,
+		size: info.Size(),
+	}
+	magic := make([]byte, 2)
+	n, _ := file.ReadAt(magic, 0)
+	t.gzipped = isGzip(magic[:n])
+
+	section := io.NewSectionReader(file, 0, t.size)
+	var r io.Reader = section
+	if t.gzipped {
+		gz, err := gzip.NewReader(bufio.NewReader(section))
+		if err != nil {
+			file.Close()
+			return nil, errors.Wrap(err, "Can't open tar")
+		}
+		r = gz
+	}
+	members := []*walker.Member{}
+	tr := tar.NewReader(r)
+	for index := 0; ; index++ {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && len(members) == 0 {
+			file.Close()
+			return nil, errors.Wrap(err, "Can't open tar")
+		}
+		if err != nil {
+			// members read before the damaged header are kept
+			members = append(members, &walker.Member{Err: err, Index: index})
+			break
+		}
+		name := walker.CleanName(h.Name, h.Typeflag == tar.TypeDir)
+		if name == "" {
+			continue
+		}
+		var offset int64
+		if !t.gzipped {
+			// the tar reader stops at the member content
+			offset, _ = section.Seek(0, io.SeekCurrent)
+		}
+		members = append(members, &walker.Member{
+			Name:   name,
+			Info:   h.FileInfo(),
+			Header: header{Header: h, offset: offset, sequential: t.gzipped || sparse(h)},
+			Index:  index,
+		})
+	}
+	t.Archive = walker.NewArchive(path, members, t, t.release, walker.NewOptions(opts...))
+	return t, nil
+}
+
+// sparse tells if the member content is stored as a sparse file
+func sparse(h *tar.Header) bool {
+	if h.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for k := range h.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// release closes the idle decoder and the archive file
+func (t *Tar) release() error {
+	t.sequential.Close()
+	return t.file.Close()
+}
+
+// tarStream reads the members of the archive in order
+type tarStream struct {
+	*tar.Reader
+	closer io.Closer
+}
+
+func (s tarStream) Next() error {
+	_, err := s.Reader.Next()
+	return err
+}
+
+func (s tarStream) Close() error {
+	return s.closer.Close()
+}
+
+// openSequential reads the archive up to the member, from the start or from
+// the last member read
+func (t *Tar) openSequential(m *walker.Member) (io.ReadCloser, error) {
+	return t.sequential.Open(m.Index, "", func() (walker.Stream, error) {
+		var (
+			r      io.Reader = bufio.NewReader(io.NewSectionReader(t.file, 0, t.size))
+			closer io.Closer = ioutil.NopCloser(nil)
+		)
+		if t.gzipped {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			r, closer = gz, gz
+		}
+		return tarStream{Reader: tar.NewReader(r), closer: closer}, nil
+	})
+}
+
+// OpenMember gives a reader on the member content
+// implements walker.MemberOpener
+func (t *Tar) OpenMember(m *walker.Member, path string) (io.ReadCloser, error) {
+	rc, err := t.openSequential(m)
+	if err != nil {
+		return nil, &walker.Error{Path: path, Op: "open", Err: err}
+	}
+	return rc, nil
+}
+
+// OpenSection gives the content of members of uncompressed archives, read
+// directly from the archive
+// implements walker.SectionOpener
+func (t *Tar) OpenSection(m *walker.Member) *io.SectionReader {
+	h := m.Header.(header)
+	if h.sequential {
+		return nil
+	}
+	return io.NewSectionReader(t.file, h.offset, h.Size)
+}
+
+// xattrPrefix prefixes PAX records of extended attributes
+const xattrPrefix = "SCHILY.xattr."
+
+// MemberMeta gives owners and extended attributes recorded in the member header
+// implements walker.MemberOpener
+func (t *Tar) MemberMeta(m *walker.Member) walker.Meta {
+	h := m.Header.(header)
+	meta := walker.OwnerMeta(h.Uid, h.Gid)
+	if h.Uname != "" {
+		meta[walker.MetaOwner] = h.Uname
+	}
+	if h.Gname != "" {
+		meta[walker.MetaGroup] = h.Gname
+	}
+	x := map[string][]byte{}
+	for k, v := range h.PAXRecords {
+		if strings.HasPrefix(k, xattrPrefix) {
+			x[k[len(xattrPrefix):]] = []byte(v)
+		}
+	}
+	if len(x) > 0 {
+		meta[walker.MetaXattrs] = x
+	}
+	return meta
+}
@@ -0,0 +1,295 @@
+package tarwalker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/simulot/golib/file/walker"
+	"github.com/simulot/golib/file/walker/walkertest"
+)
+
+var testTarMembers = []string{"file_a.txt", "file_b.txt", "subtree/file_d.txt", "subtree/file_e.txt"}
+
+// writeTar writes an archive of test members whose content is their base name
+func writeTar(t *testing.T, path string, gzipped bool) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if gzipped {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, name := range testTarMembers {
+		content := filepath.Base(name) + "\n"
+		h := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Uname: "alice", PAXRecords: map[string]string{"SCHILY.xattr.user.tag": "blue"}}
+		if err = tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.WriteString(tw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTar(t *testing.T) {
+	dir := t.TempDir()
+	cases := []walkertest.Case{}
+	for _, name := range []string{"test.tar", "test.tar.gz", "test.tgz"} {
+		path := filepath.Join(dir, name)
+		writeTar(t, path, name != "test.tar")
+		cases = append(cases, walkertest.Case{Path: path, Names: testTarMembers, Meta: []string{walker.MetaOwner, walker.MetaXattrs}})
+	}
+	walkertest.Archive(t, Open, cases...)
+}
+
+func TestTarMeta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.tar")
+	writeTar(t, path, false)
+	w, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer w.Close()
+	for item := range w.Items() {
+		m := item.Meta()
+		if m[walker.MetaOwner] != "alice" {
+			t.Errorf("Expected owner 'alice', but got %v", m[walker.MetaOwner])
+		}
+		if x, _ := m[walker.MetaXattrs].(map[string][]byte); string(x["user.tag"]) != "blue" {
+			t.Errorf("Expected xattr 'blue', but got %v", m[walker.MetaXattrs])
+		}
+		item.Close()
+	}
+}
+
+func TestTarSequential(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.tgz")
+	writeTar(t, path, true)
+	w, err := Open(path, walker.LeakDetection())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	z := w.(walker.Finder)
+	// forward, skipping members and leaving one partly read, then backward
+	for _, name := range []string{"file_a.txt", "subtree/file_d.txt", "subtree/file_e.txt", "file_b.txt", "file_b.txt"} {
+		item, err := z.Lookup(name)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if name == "subtree/file_d.txt" {
+			r, err := item.Reader()
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			b := make([]byte, 2)
+			if _, err = io.ReadFull(r, b); err != nil || string(b) != "fi" {
+				t.Errorf("Expected 'fi', but got '%s', %v", b, err)
+			}
+		} else {
+			walkertest.CheckContent(t, item)
+		}
+		item.Close()
+	}
+	if err = w.(*Tar).CloseWait(context.Background()); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+}
+
+func TestTarDamagedHeader(t *testing.T) {
+	for _, name := range []string{"test.tar", "test.tgz"} {
+		path := filepath.Join(t.TempDir(), name)
+		gzipped := strings.HasSuffix(name, ".tgz")
+		writeTar(t, path, false)
+		// cut the archive in the middle of the third header, after two
+		// members made of a PAX header, its records, a header and content
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = b[:2*4*512+100]
+		if gzipped {
+			buf := new(bytes.Buffer)
+			gz := gzip.NewWriter(buf)
+			gz.Write(b)
+			gz.Close()
+			b = buf.Bytes()
+		}
+		if err = ioutil.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, skip := range []bool{true, false} {
+			log := new(bytes.Buffer)
+			reported := []string{}
+			opts := []walker.Option{walker.WithLogger(slog.New(slog.NewTextHandler(log, nil)))}
+			if skip {
+				opts = append(opts, walker.OnError(func(err error) error {
+					reported = append(reported, err.(*walker.Error).Op)
+					return nil
+				}))
+			}
+			w, err := Open(path, opts...)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			got := []string{}
+			for item := range w.Items() {
+				got = append(got, item.Name())
+				walkertest.CheckContent(t, item)
+				item.Close()
+			}
+			w.Close()
+			if expected := []string{"file_a.txt", "file_b.txt"}; !reflect.DeepEqual(expected, got) {
+				t.Errorf("Expected %#q, but got %#q", expected, got)
+			}
+			if skip {
+				if !reflect.DeepEqual(reported, []string{"read header"}) || w.Err() != nil {
+					t.Errorf("Expected the damaged header to be reported, but got %#q, %v", reported, w.Err())
+				}
+				if !strings.Contains(log.String(), "msg=\"Entry skipped\" file="+path) {
+					t.Errorf("Expected the damaged header to be logged, but got %q", log.String())
+				}
+			} else if e, ok := w.Err().(*walker.Error); !ok || e.Op != "read header" || e.Path != path {
+				t.Errorf("Expected the walk to be aborted on the damaged header, but got %v", w.Err())
+			}
+		}
+	}
+}
+
+func TestTarEscapingNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "escape.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	for _, name := range []string{"../../../../e", "/abs/f.txt", "./ok/../g.txt", "./"} {
+		content := filepath.Base(name) + "\n"
+		h := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}
+		if strings.HasSuffix(name, "/") {
+			h = &tar.Header{Name: name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		if err = tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Size > 0 {
+			io.WriteString(tw, content)
+		}
+	}
+	tw.Close()
+	f.Close()
+
+	w, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	got := []string{}
+	for item := range w.Items() {
+		if !strings.HasPrefix(item.FullName(), path+string(filepath.Separator)) {
+			t.Errorf("Expected '%s' to be inside the archive", item.FullName())
+		}
+		got = append(got, filepath.ToSlash(item.MemberName()))
+		item.Close()
+	}
+	sort.Strings(got)
+	if expected := []string{"/abs/f.txt", "/e", "/g.txt"}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %#q, but got %#q", expected, got)
+	}
+	item, err := w.(walker.Finder).Lookup("e")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	walkertest.CheckContent(t, item)
+	item.Close()
+	w.Close()
+}
+
+func TestTarDetection(t *testing.T) {
+	dir := t.TempDir()
+	writeTar(t, filepath.Join(dir, "backup.dat"), false)
+	writeTar(t, filepath.Join(dir, "backup.bin"), true)
+	writeTar(t, filepath.Join(dir, "report.docx"), false)
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.tar"), []byte("notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"backup.dat", "backup.bin", "report.docx"} {
+		if f, ok := walker.Detect(filepath.Join(dir, name)); !ok || f.Name != "tar" {
+			t.Errorf("Expected '%s' to be detected as tar, but got %q, %v", name, f.Name, ok)
+		}
+	}
+	if _, ok := walker.Detect(filepath.Join(dir, "report.docx"), walker.NoDescend(".DOCX")); ok {
+		t.Errorf("Expected 'report.docx' not to be descended into with NoDescend")
+	}
+	if f, ok := walker.Detect(filepath.Join(dir, "notes.tar")); ok {
+		t.Errorf("Expected 'notes.tar' not to be a tar, but got %q", f.Name)
+	}
+
+	cases := []struct {
+		opts     []walker.Option
+		expected []string
+	}{
+		{
+			nil,
+			[]string{"backup.bin/file_a.txt", "backup.dat/file_a.txt", "notes.tar", "report.docx/file_a.txt"},
+		},
+		{
+			[]walker.Option{walker.UseRegistry(walker.NewRegistry())},
+			[]string{"backup.bin", "backup.dat", "notes.tar", "report.docx"},
+		},
+		{
+			[]walker.Option{walker.NoDescend(".bin", ".docx")},
+			[]string{"backup.bin", "backup.dat/file_a.txt", "notes.tar", "report.docx"},
+		},
+	}
+	for _, c := range cases {
+		failed := []string{}
+		opts := append(c.opts, walker.OnError(func(err error) error {
+			if e, ok := err.(*walker.Error); ok {
+				failed = append(failed, filepath.Base(e.Path))
+			}
+			return nil
+		}))
+		w, err := walker.Open(dir, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		got := []string{}
+		for item := range w.Items() {
+			name := filepath.ToSlash(item.FullName()[len(dir)+1:])
+			if strings.Contains(name, "/") && !strings.HasSuffix(name, "/file_a.txt") {
+				item.Close()
+				continue
+			}
+			got = append(got, name)
+			item.Close()
+		}
+		w.Close()
+		sort.Strings(got)
+		if !reflect.DeepEqual(c.expected, got) {
+			t.Errorf("Expected %#q, but got %#q", c.expected, got)
+		}
+		if len(failed) != 0 {
+			t.Errorf("Unexpected failures on %#q", failed)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package tarwalker walks through tar archives, gzipped or not, and writes
+// walker items into tar archives.
+package tarwalker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/walker"
+)
+
+// Writer writes walker items into a gzipped tar archive.
+type Writer struct {
+	gz    *gzip.Writer
+	tw    *tar.Writer
+	level int
+}
+
+// WriterOption is a functional option for NewWriter
+type WriterOption func(*Writer)
+
+// CompressionLevel set the gzip compression level, from gzip.NoCompression to
+// gzip.BestCompression.
+func CompressionLevel(level int) WriterOption {
+	return func(w *Writer) {
+		w.level = level
+	}
+}
+
+// NewWriter creates a tar.gz archive on w.
+func NewWriter(w io.Writer, opts ...WriterOption) (*Writer, error) {
+	tw := &Writer{
+		level: gzip.DefaultCompression,
+	}
+	for _, opt := range opts {
+		opt(tw)
+	}
+	gz, err := gzip.NewWriterLevel(w, tw.level)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't create tar.gz writer")
+	}
+	tw.gz = gz
+	tw.tw = tar.NewWriter(gz)
+	return tw, nil
+}
+
+// Write adds the item to the archive with its member name, modification time and
+// permissions. Symbolic links are written as their target. Only regular files
+// have content. The item isn't closed.
+func (w *Writer) Write(item walker.WalkItem) error {
+	name, err := walker.ArchiveName(item)
+	if err != nil {
+		return err
+	}
+	info, err := walker.ArchiveInfo(item)
+	if err != nil {
+		return err
+	}
+	h, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return errors.Wrapf(err, "Can't make tar header for '%s'", item.FullName())
+	}
+	h.Name = name
+	if info.IsDir() {
+		h.Name += "/"
+	}
+	if h.Typeflag != tar.TypeReg {
+		return errors.Wrapf(w.tw.WriteHeader(h), "Can't write '%s' into tar", item.FullName())
+	}
+	r, err := item.RawReader()
+	if err != nil {
+		return errors.Wrapf(err, "Can't read '%s'", item.FullName())
+	}
+	if err = w.tw.WriteHeader(h); err != nil {
+		return errors.Wrapf(err, "Can't write '%s' into tar", item.FullName())
+	}
+	_, err = io.Copy(w.tw, r)
+	return errors.Wrapf(err, "Can't write '%s' into tar", item.FullName())
+}
+
+// WriteAll writes all items of the channel into the archive, and close them.
+// It stops writing at first error, but the channel is drained.
+func (w *Writer) WriteAll(items chan walker.WalkItem) error {
+	var err error
+	for item := range items {
+		if err == nil {
+			err = w.Write(item)
+		}
+		item.Close()
+	}
+	return err
+}
+
+// Close finishes the tar archive and the gzip stream.
+// The underlying writer isn't closed.
+func (w *Writer) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return errors.Wrap(err, "Can't close tar")
+	}
+	return errors.Wrap(w.gz.Close(), "Can't close tar.gz")
+}
@@ -0,0 +1,122 @@
+package tarwalker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/simulot/golib/file/walker"
+)
+
+func TestWriter(t *testing.T) {
+	source, err := walker.Open("../test/tree", walker.Dirs(walker.DirsPreOrder))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	buf := new(bytes.Buffer)
+	w, err := NewWriter(buf, CompressionLevel(gzip.BestCompression))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err = w.WriteAll(source.Items()); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	source.Close()
+
+	gz, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	got := []string{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, h.Name)
+		info, err := os.Stat(filepath.Join("..", filepath.FromSlash(h.Name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !h.ModTime.Equal(info.ModTime().Truncate(1e9)) {
+			t.Errorf("Expected '%s' modification time to be %s, but got %s", h.Name, info.ModTime(), h.ModTime)
+		}
+		if h.FileInfo().Mode() != info.Mode() {
+			t.Errorf("Expected '%s' mode to be %s, but got %s", h.Name, info.Mode(), h.FileInfo().Mode())
+		}
+		if info.IsDir() {
+			continue
+		}
+		content, _ := ioutil.ReadAll(tr)
+		if expected := filepath.Base(h.Name) + "\n"; string(content) != expected {
+			t.Errorf("Expected '%s' content to be '%s', but got '%s'", h.Name, expected, content)
+		}
+	}
+	expected := []string{"test/tree/file_a.txt", "test/tree/file_b.txt", "test/tree/file_c.txt", "test/tree/subtree/", "test/tree/subtree/file_d.txt", "test/tree/subtree/file_e.txt", "test/tree/subtree/file_f.txt"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %#q, but got %#q", expected, got)
+	}
+}
+
+func TestWriterSymlink(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a.txt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link.txt")); err != nil {
+		t.Skip(err)
+	}
+	source, err := walker.Open(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	buf := new(bytes.Buffer)
+	w, err := NewWriter(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err = w.WriteAll(source.Items()); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	source.Close()
+
+	gz, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	got := map[string]string{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			t.Errorf("Expected '%s' to be a regular file, but got type %c", h.Name, h.Typeflag)
+		}
+		content, _ := ioutil.ReadAll(tr)
+		got[filepath.Base(h.Name)] = string(content)
+	}
+	if expected := map[string]string{"a.txt": "a.txt\n", "link.txt": "a.txt\n"}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %q, but got %q", expected, got)
+	}
+}
@@ -0,0 +1,121 @@
+package walker
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Tracker keeps track of items and readers emitted by an archive walker. The archive
+// resources are released once the walker is closed and all items and readers
+// are closed too.
+type Tracker struct {
+	mu      sync.Mutex
+	open    map[interface{}]Leak // open references, with the stack where they were emitted
+	stacks  bool                 // record emission stacks
+	closing bool                 // the walker is closed
+	release func() error         // releases archive resources
+	err     error                // error returned by release
+	done    chan struct{}        // closed when resources are released
+}
+
+// NewTracker creates a tracker calling release when the walker and all its items are closed.
+// When leak detection is on, the stack of item emission is recorded.
+func NewTracker(release func() error, o Options) *Tracker {
+	return &Tracker{
+		open:    map[interface{}]Leak{},
+		stacks:  o.LeakDetection,
+		release: release,
+		done:    make(chan struct{}),
+	}
+}
+
+// Add remembers the reference as open. The name is used for reporting leaks.
+func (t *Tracker) Add(ref interface{}, name string) {
+	l := Leak{Name: name}
+	if t.stacks {
+		l.Stack = string(debug.Stack())
+	}
+	t.mu.Lock()
+	t.open[ref] = l
+	t.mu.Unlock()
+}
+
+// Done forgets the reference. Calling Done several times for the same reference is harmless.
+func (t *Tracker) Done(ref interface{}) {
+	t.mu.Lock()
+	delete(t.open, ref)
+	t.releaseIfIdle()
+	t.mu.Unlock()
+}
+
+// Close marks the walker as closed. It returns immediately, resources are
+// released when all items are closed.
+func (t *Tracker) Close() {
+	t.mu.Lock()
+	t.closing = true
+	t.releaseIfIdle()
+	t.mu.Unlock()
+}
+
+// releaseIfIdle must be called with the lock held
+func (t *Tracker) releaseIfIdle() {
+	if !t.closing || len(t.open) > 0 || t.release == nil {
+		return
+	}
+	t.err = t.release()
+	t.release = nil
+	close(t.done)
+}
+
+// Wait waits until resources are released or the context is done. In the
+// latter case, a *LeakError lists the items and readers still open.
+func (t *Tracker) Wait(ctx context.Context) error {
+	select {
+	case <-t.done:
+		return t.err
+	case <-ctx.Done():
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.done:
+		return t.err
+	default:
+	}
+	e := &LeakError{Err: ctx.Err()}
+	for _, l := range t.open {
+		e.Items = append(e.Items, l)
+	}
+	sort.Slice(e.Items, func(i, j int) bool {
+		return e.Items[i].Name < e.Items[j].Name
+	})
+	return e
+}
+
+// Leak describes an item or a reader that hasn't been closed
+type Leak struct {
+	Name  string // Item full name
+	Stack string // Stack at item emission, when leak detection is on
+}
+
+// LeakError is returned when items or readers are still open at walker closing
+type LeakError struct {
+	Items []Leak
+	Err   error // context error
+}
+
+func (e *LeakError) Error() string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "%d reference(s) still open: %s", len(e.Items), e.Err)
+	for _, l := range e.Items {
+		b.WriteString("\n\t" + l.Name)
+		if l.Stack != "" {
+			b.WriteString("\n" + l.Stack)
+		}
+	}
+	return b.String()
+}
@@ -5,46 +5,407 @@ package walker
 
 import (
 	"io"
+	"log/slog"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/encoding"
+	textencoding "golang.org/x/text/encoding"
 )
 
 // ErrWalkerNotFound error when the given file name can't be open
 var ErrWalkerNotFound = errors.New("Not an Opener")
 
+// ErrTooLarge is returned when an item is too large to be spooled
+var ErrTooLarge = errors.New("Item too large")
+
+// ErrPassword is the cause of errors on encrypted members when no password fits
+var ErrPassword = errors.New("Wrong or missing password")
+
+// ErrIsDirectory is returned when reading an item that is a directory
+var ErrIsDirectory = errors.New("Item is a directory")
+
+// ErrOutsideRoot is returned when a looked up name leaves the walker root
+var ErrOutsideRoot = errors.New("Name outside of the root")
+
 // Opener is the function signature of Walker opener
-type Opener func(string) (Walker, error)
+type Opener func(string, ...Option) (Walker, error)
 
 // Matcher tells if the file can be open by the opener
 type Matcher func(string) bool
 
-var walkerRegister = []struct {
-	Opener
-	Matcher
-}{}
+// Detector tells if the file content, given by its first bytes, can be open
+// by the opener
+type Detector func(header []byte) bool
+
+// Format describes a kind of container walkers descend into
+type Format struct {
+	Name     string   // Format name, like "zip"
+	Opener   Opener   // Opens the container
+	Matcher  Matcher  // Recognizes container names, used when there is no Detector
+	Detector Detector // Recognizes container content, optional
+	Priority int      // Formats with higher priority are tried first
+}
 
-// Register is called by concrete implementations of Walker
+// Register is called by concrete implementations of Walker recognizing
+// containers by their names only. The format is added to DefaultRegistry.
 func Register(o Opener, m Matcher) {
-	walkerRegister = append(walkerRegister, struct {
-		Opener
-		Matcher
-	}{o, m})
+	DefaultRegistry.Register(Format{Opener: o, Matcher: m})
+}
+
+// RegisterFormat is called by concrete implementations of Walker to add
+// their format to DefaultRegistry.
+func RegisterFormat(f Format) {
+	DefaultRegistry.Register(f)
+}
+
+// Magic gives a Detector recognizing one of the signatures at offset
+func Magic(offset int, signatures ...string) Detector {
+	return func(header []byte) bool {
+		for _, s := range signatures {
+			if len(header) >= offset+len(s) && string(header[offset:offset+len(s)]) == s {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// DirMode tells if and when walkers emit directory items
+type DirMode int
+
+const (
+	NoDirs        DirMode = iota // Directories are not emitted (default)
+	DirsPreOrder                 // Directories are emitted before their content
+	DirsPostOrder                // Directories are emitted after their content
+)
+
+// Error records an error met when walking an entry
+type Error struct {
+	Path   string // Full name of the entry
+	Member string // Name of the entry in its archive, empty for folder entries
+	Op     string // Operation that failed
+	Err    error  // Underlying error
+}
+
+func (e *Error) Error() string {
+	return e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+// Cause returns the underlying error
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// ErrorHandler is called with a *Error each time a walker can't process an entry.
+// When the handler returns nil, the entry is skipped and the walk continues.
+// Otherwise, the walk is aborted and the returned error is given by Walker.Err.
+// Calls are serialized by Folder, even when directories are read in parallel.
+type ErrorHandler func(err error) error
+
+// serialize makes sure the handler isn't called concurrently
+func serialize(h ErrorHandler) ErrorHandler {
+	var mu sync.Mutex
+	return func(err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return h(err)
+	}
+}
+
+// SkipErrors is an ErrorHandler that ignores all errors
+func SkipErrors(err error) error {
+	return nil
+}
+
+// abortOnError is the default ErrorHandler
+func abortOnError(err error) error {
+	return err
+}
+
+// Options drives the way walkers explore their content.
+// They are given to Open and passed down to archive walkers.
+type Options struct {
+	DirMode DirMode      // Emission of directory items
+	OnError ErrorHandler // Called on entries errors, abort the walk by default
+	Workers int          // Number of directories read at once by Folder
+	Ordered bool         // Parallel Folder emits items in the same order as sequential walk
+
+	LeakDetection bool  // Archive walkers record where items are emitted to report unclosed ones
+	SpoolLimit    int64 // Maximum size of members spooled for random access, or extracted from nested archives
+
+	Passwords PasswordProvider // Candidate passwords for encrypted archives
+
+	NameEncoding textencoding.Encoding // Encoding of archive member names that aren't UTF-8
+	Recover      bool                  // Salvage entries of archives with a damaged index
+
+	Descent  map[string]bool // Extensions opted in (true) or out (false) of container detection
+	Registry *Registry       // Container formats walkers descend into
+
+	Logger *slog.Logger // Receives walk events, like skipped entries
+}
+
+// PasswordProvider gives candidate passwords for the encrypted archive
+type PasswordProvider func(archive string) []string
+
+// DefaultSpoolLimit is the default maximum size of spooled members
+const DefaultSpoolLimit = 64 << 20
+
+// Option is a functional option for walker openers
+type Option func(*Options)
+
+// Dirs set the emission mode of directory items
+func Dirs(mode DirMode) Option {
+	return func(o *Options) {
+		o.DirMode = mode
+	}
+}
 
+// OnError set the handler called on entries errors
+func OnError(h ErrorHandler) Option {
+	return func(o *Options) {
+		o.OnError = h
+	}
+}
+
+// Workers set the number of directories that are read at once by Folder.
+// Items are emitted in no particular order unless Ordered option is given.
+func Workers(n int) Option {
+	return func(o *Options) {
+		o.Workers = n
+	}
+}
+
+// Ordered makes parallel Folder emitting items in the same order as
+// a sequential walk.
+func Ordered() Option {
+	return func(o *Options) {
+		o.Ordered = true
+	}
+}
+
+// LeakDetection makes archive walkers recording the stack where items are
+// emitted, to report items that are not closed. Intended for tests.
+func LeakDetection() Option {
+	return func(o *Options) {
+		o.LeakDetection = true
+	}
+}
+
+// SpoolLimit set the maximum size of compressed members that can be
+// spooled into temporary files to give them random access, and of nested
+// archives extracted by OpenPath
+func SpoolLimit(n int64) Option {
+	return func(o *Options) {
+		o.SpoolLimit = n
+	}
+}
+
+// Passwords adds candidate passwords for encrypted archives
+func Passwords(passwords ...string) Option {
+	return WithPasswordProvider(func(string) []string {
+		return passwords
+	})
+}
+
+// WithPasswordProvider adds a provider of candidate passwords, called once
+// per encrypted archive. Candidates of previous providers are tried first.
+func WithPasswordProvider(p PasswordProvider) Option {
+	return func(o *Options) {
+		previous := o.Passwords
+		if previous == nil {
+			o.Passwords = p
+			return
+		}
+		o.Passwords = func(archive string) []string {
+			return append(previous(archive), p(archive)...)
+		}
+	}
+}
+
+// NameEncoding set the encoding of archive member names that aren't flagged
+// as UTF-8. Zip archives default to IBM code page 437.
+func NameEncoding(e textencoding.Encoding) Option {
+	return func(o *Options) {
+		o.NameEncoding = e
+	}
+}
+
+// Recover makes archive walkers salvaging entries when the archive index is
+// damaged or missing, by scanning the archive content.
+func Recover() Option {
+	return func(o *Options) {
+		o.Recover = true
+	}
+}
+
+// UseRegistry set the registry of container formats walkers descend into,
+// instead of DefaultRegistry
+func UseRegistry(r *Registry) Option {
+	return func(o *Options) {
+		o.Registry = r
+	}
+}
+
+// WithLogger set the logger receiving walk events. By default, events go to
+// slog default logger, tagged with component=walker.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// Fail reports an entry error to the error handler, and logs the entry
+// when it is skipped. It returns the error that aborts the walk, if any.
+func (o Options) Fail(err *Error) error {
+	if abort := o.OnError(err); abort != nil {
+		return abort
+	}
+	if err.Member != "" {
+		o.Logger.Warn("Entry skipped", "file", err.Path, "member", err.Member, "stage", err.Op, "error", err.Err)
+		return nil
+	}
+	o.Logger.Warn("Entry skipped", "file", err.Path, "stage", err.Op, "error", err.Err)
+	return nil
+}
+
+// NewOptions applies options over default values
+func NewOptions(opts ...Option) Options {
+	o := Options{
+		OnError:    abortOnError,
+		SpoolLimit: DefaultSpoolLimit,
+		Descent:    map[string]bool{},
+		Registry:   DefaultRegistry,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Logger == nil {
+		o.Logger = slog.Default().With("component", "walker")
+	}
+	return o
 }
 
 // Walker interface for archive walker
 type Walker interface {
 	Close()
 	Items() chan WalkItem
+	Err() error // Error that has aborted the walk, once Items channel is closed
+}
+
+// Finder is implemented by walkers able to reach a member without walking
+// through all items. Names are relative to the walker root, and slash separated.
+type Finder interface {
+	Lookup(name string) (WalkItem, error) // Gives the member item, that must be closed
+	Stat(name string) (os.FileInfo, error)
+}
+
+// ReadSeekAtCloser gives random access on an item content
+type ReadSeekAtCloser interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// RandomAccess is implemented by items giving random access to their content
+type RandomAccess interface {
+	OpenRandom() (ReadSeekAtCloser, error) // Gives an independent reader, to be closed
 }
 
 // WalkItem interface of archive item
 type WalkItem interface {
-	os.FileInfo                 // Underlaying file structure
-	FullName() string           // Give the full path of the file
-	Reader() (io.Reader, error) // Give a reader on archive item
-	Close()                     // Items must be closed.
-	MemberName() string         // When Walkitem is an archive, returns archive member name, otherwise returns file name
-	Clone() WalkItem            // Clone item to have more readers on the same Item
+	os.FileInfo                                            // Underlaying file structure
+	FullName() string                                      // Give the full path of the file
+	Reader() (io.Reader, error)                            // Deprecated: TextReader() for folders, RawReader() for archives
+	RawReader() (io.Reader, error)                         // Give a reader on the exact bytes of the item
+	TextReader(opts ...encoding.Option) (io.Reader, error) // Give a reader on the item content converted into UTF-8
+	Open() (io.ReadCloser, error)                          // Give an independent reader on the item content as stored, to be closed
+	Close()                                                // Items must be closed.
+	MemberName() string                                    // When Walkitem is an archive, returns archive member name, otherwise returns file name
+	Clone() WalkItem                                       // Clone item to have more readers on the same Item
+	Meta() Meta                                            // Give metadata like owners or archive headers
+}
+
+// ArchiveName gives the item's member name as a relative slash separated path,
+// suitable for archive headers. Names can't escape the archive: leading slashes
+// and ".." components that climb above the root are dropped, so folder items
+// walked from "../test/tree" and "test/tree" get the same name "test/tree/...".
+func ArchiveName(item WalkItem) (string, error) {
+	name := path.Clean("/" + filepath.ToSlash(item.MemberName()))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		return "", errors.Errorf("Can't archive '%s' without a member name", item.FullName())
+	}
+	return name, nil
+}
+
+// ArchiveInfo gives the file info to archive the item with. Symbolic links
+// are followed like the folder walker does: they are archived as their target.
+func ArchiveInfo(item WalkItem) (os.FileInfo, error) {
+	if item.Mode()&os.ModeSymlink == 0 {
+		return item, nil
+	}
+	info, err := os.Stat(item.FullName())
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can't follow link '%s'", item.FullName())
+	}
+	return info, nil
+}
+
+// Closers keeps track of readers opened by an item, to close them with the item
+type Closers struct {
+	mu   sync.Mutex
+	list []io.Closer
+}
+
+// Add remembers the closer
+func (c *Closers) Add(closer io.Closer) {
+	c.mu.Lock()
+	c.list = append(c.list, closer)
+	c.mu.Unlock()
+}
+
+// Close closes all remembered closers
+func (c *Closers) Close() {
+	c.mu.Lock()
+	list := c.list
+	c.list = nil
+	c.mu.Unlock()
+	for _, closer := range list {
+		closer.Close()
+	}
+}
+
+// DirStack retains directory items until all their content has been emitted.
+// Walkers use it to emit directories in post-order. Items must be
+// visited in an order where a directory content follows the directory itself.
+type DirStack struct {
+	dirs []WalkItem
+}
+
+// Push retains the directory item
+func (s *DirStack) Push(dir WalkItem) {
+	s.dirs = append(s.dirs, dir)
+}
+
+// Pop sends to out retained directories that aren't ancestors of path
+func (s *DirStack) Pop(path string, out chan WalkItem) {
+	for len(s.dirs) > 0 {
+		top := s.dirs[len(s.dirs)-1]
+		if strings.HasPrefix(path, top.FullName()+string(filepath.Separator)) {
+			return
+		}
+		s.dirs = s.dirs[:len(s.dirs)-1]
+		out <- top
+	}
+}
+
+// Flush sends to out all remaining directories
+func (s *DirStack) Flush(out chan WalkItem) {
+	s.Pop("", out)
 }
@@ -64,3 +64,23 @@ func TestOpen(t *testing.T) {
 		})
 	}
 }
+
+func TestArchiveName(t *testing.T) {
+	for path, expected := range map[string]string{
+		"test/tree/file_a.txt":    "test/tree/file_a.txt",
+		"../test/tree/file_a.txt": "test/tree/file_a.txt",
+		"/test/tree/file_a.txt":   "test/tree/file_a.txt",
+		"test/../../file_a.txt":   "file_a.txt",
+	} {
+		got, err := ArchiveName(&Item{path: path})
+		if err != nil {
+			t.Errorf("Unexpected error %s", err)
+		}
+		if got != expected {
+			t.Errorf("Expecting archive name of '%s' to be '%s', but got '%s'", path, expected, got)
+		}
+	}
+	if _, err := ArchiveName(&Item{path: "/"}); err == nil {
+		t.Errorf("Expecting an error for an item without member name")
+	}
+}
@@ -0,0 +1,216 @@
+// Package walkertest gives the conformance tests shared by archive walkers.
+//
+// Archives under test hold files whose content is their base name followed
+// by a new line, like the walker test folders.
+package walkertest
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simulot/golib/file/walker"
+)
+
+// FlatNames are the members of archives made from the walker test/flat folder
+var FlatNames = []string{"file_a.txt", "file_b.txt", "file_c.txt", "file_d.txt", "file_e.txt", "file_f.txt"}
+
+// TreeNames are the members of archives made from the walker test/tree folder
+var TreeNames = []string{"file_a.txt", "file_b.txt", "file_c.txt", "subtree/file_d.txt", "subtree/file_e.txt", "subtree/file_f.txt"}
+
+// Opener opens the archive under test
+type Opener func(path string, opts ...walker.Option) (walker.Walker, error)
+
+// Case is an archive to check
+type Case struct {
+	Path  string   // Archive path
+	Names []string // Slash separated names of the files held by the archive
+	Meta  []string // Metadata keys given for every file
+}
+
+// closeWaiter is implemented by archive walkers
+type closeWaiter interface {
+	CloseWait(ctx context.Context) error
+}
+
+// CheckContent checks that the item content is its name
+func CheckContent(t *testing.T, item walker.WalkItem) {
+	t.Helper()
+	reader, err := item.RawReader()
+	if err != nil {
+		t.Errorf("Unexpected error when opening '%s': %s", item.FullName(), err)
+		return
+	}
+	content, _ := bufio.NewReader(reader).ReadString('\n')
+	content = strings.TrimRight(content, "\n")
+	if content != item.Name() {
+		t.Errorf("Expected content of '%s' file to be '%s', but got '%s'!", item.Name(), item.Name(), content)
+	}
+}
+
+// Archive runs the conformance tests on each case: walking items, walking
+// directories, looking up members and reading them at random.
+func Archive(t *testing.T, open Opener, cases ...Case) {
+	for _, c := range cases {
+		c := c
+		t.Run(filepath.Base(c.Path), func(t *testing.T) {
+			t.Run("Items", func(t *testing.T) { checkItems(t, open, c) })
+			t.Run("Dirs", func(t *testing.T) { checkDirs(t, open, c) })
+			t.Run("Lookup", func(t *testing.T) { checkLookup(t, open, c) })
+			t.Run("OpenRandom", func(t *testing.T) { checkOpenRandom(t, open, c) })
+		})
+	}
+}
+
+// member gives the name of the item relative to the archive
+func member(c Case, item walker.WalkItem) string {
+	return filepath.ToSlash(item.FullName()[len(c.Path)+1:])
+}
+
+// dirs gives the directories implied by the names
+func dirs(names []string) map[string]bool {
+	d := map[string]bool{}
+	for _, name := range names {
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			d[dir] = true
+		}
+	}
+	return d
+}
+
+func checkItems(t *testing.T, open Opener, c Case) {
+	w, err := open(c.Path, walker.LeakDetection())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	got := []string{}
+	for item := range w.Items() {
+		got = append(got, member(c, item))
+		CheckContent(t, item)
+		m := item.Meta()
+		for _, key := range c.Meta {
+			if _, ok := m[key]; !ok {
+				t.Errorf("Expected %s in metadata of '%s', but got %v", key, item.Name(), m)
+			}
+		}
+		item.Close()
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(c.Names, got) {
+		t.Errorf("Expected %#q, but got %#q", c.Names, got)
+	}
+	if err = w.Err(); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = w.(closeWaiter).CloseWait(ctx); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+}
+
+// checkDirs checks that directories come before their content in
+// pre-order, and after it in post-order
+func checkDirs(t *testing.T, open Opener, c Case) {
+	expected := dirs(c.Names)
+	for _, mode := range []walker.DirMode{walker.DirsPreOrder, walker.DirsPostOrder} {
+		w, err := open(c.Path, walker.Dirs(mode))
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		order := map[string]int{}
+		got := map[string]bool{}
+		for item := range w.Items() {
+			name := member(c, item)
+			order[name] = len(order)
+			if item.IsDir() {
+				got[name] = true
+			}
+			item.Close()
+		}
+		w.Close()
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("With mode %d, expected directories %v, but got %v", mode, expected, got)
+		}
+		for _, name := range c.Names {
+			dir := path.Dir(name)
+			if dir == "." {
+				continue
+			}
+			if before := order[dir] < order[name]; before != (mode == walker.DirsPreOrder) {
+				t.Errorf("With mode %d, '%s' comes at %d, and its directory at %d", mode, name, order[name], order[dir])
+			}
+		}
+	}
+}
+
+func checkLookup(t *testing.T, open Opener, c Case) {
+	w, err := open(c.Path)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer w.Close()
+	z := w.(walker.Finder)
+	for _, name := range c.Names {
+		for _, n := range []string{name, "/" + name} {
+			item, err := z.Lookup(n)
+			if err != nil {
+				t.Errorf("Unexpected error %s", err)
+				continue
+			}
+			CheckContent(t, item)
+			item.Close()
+		}
+	}
+	for dir := range dirs(c.Names) {
+		if info, err := z.Stat(dir); err != nil || !info.IsDir() {
+			t.Errorf("Expected '%s' to be a directory, but got %v, %v", dir, info, err)
+		}
+	}
+	if _, err := z.Lookup("file_z.txt"); !os.IsNotExist(err) {
+		t.Errorf("Expected not exist error, but got %v", err)
+	}
+}
+
+// checkOpenRandom checks that random readers outlive their item and the
+// walker, and that the archive is released once they are closed
+func checkOpenRandom(t *testing.T, open Opener, c Case) {
+	w, err := open(c.Path, walker.LeakDetection())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	name := c.Names[len(c.Names)-1]
+	item, err := w.(walker.Finder).Lookup(name)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	r, err := item.(walker.RandomAccess).OpenRandom()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	item.Close()
+	w.Close()
+	expected := path.Base(name)[5:] + "\n"
+	b := make([]byte, len(expected))
+	if _, err = r.ReadAt(b, 5); err != nil || string(b) != expected {
+		t.Errorf("Expected %q, but got %q, %v", expected, b, err)
+	}
+	r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = w.(closeWaiter).CloseWait(ctx); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	if _, err = ioutil.ReadAll(r); err == nil {
+		t.Errorf("Expected random reader to be closed")
+	}
+}
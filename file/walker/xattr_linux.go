@@ -0,0 +1,34 @@
+package walker
+
+import (
+	"bytes"
+	"syscall"
+)
+
+// xattrs gives extended attributes of the file
+func xattrs(path string) map[string][]byte {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil
+	}
+	list := make([]byte, size)
+	if size, err = syscall.Listxattr(path, list); err != nil {
+		return nil
+	}
+	x := map[string][]byte{}
+	for _, name := range bytes.Split(list[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		n, err := syscall.Getxattr(path, string(name), nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, n)
+		if n, err = syscall.Getxattr(path, string(name), value); err != nil {
+			continue
+		}
+		x[string(name)] = value[:n]
+	}
+	return x
+}
@@ -0,0 +1,27 @@
+package walker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestXattrs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xattr.txt")
+	if err := ioutil.WriteFile(path, []byte("xattr"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Setxattr(path, "user.golib", []byte("walker"), 0); err != nil {
+		t.Skipf("Extended attributes not supported: %s", err)
+	}
+	item, err := OpenPath(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer item.Close()
+	x, _ := item.Meta()[MetaXattrs].(map[string][]byte)
+	if string(x["user.golib"]) != "walker" {
+		t.Errorf("Expected xattr user.golib to be 'walker', but got %q", x)
+	}
+}
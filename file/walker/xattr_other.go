@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package walker
+
+// xattrs isn't implemented on this platform
+func xattrs(path string) map[string][]byte {
+	return nil
+}
@@ -0,0 +1,261 @@
+package zipwalker
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/walker"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Encryption related constants
+const (
+	flagEncrypted      = 0x1    // General purpose flag: the member is encrypted
+	flagDataDescriptor = 0x8    // General purpose flag: sizes and CRC follow the data
+	methodAES          = 99     // WinZip AES encryption method
+	aesExtraID         = 0x9901 // WinZip AES extra field
+	aesAuthLen         = 10     // Authentication code length
+	zipCryptoHeader    = 12     // Traditional PKWARE encryption header length
+)
+
+// zipCrypto implements the traditional PKWARE encryption
+type zipCrypto struct {
+	keys [3]uint32
+}
+
+func newZipCrypto(password []byte) *zipCrypto {
+	z := &zipCrypto{keys: [3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for _, b := range password {
+		z.update(b)
+	}
+	return z
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[(crc^uint32(b))&0xff] ^ (crc >> 8)
+}
+
+func (z *zipCrypto) update(b byte) {
+	z.keys[0] = crc32Update(z.keys[0], b)
+	z.keys[1] = (z.keys[1]+z.keys[0]&0xff)*134775813 + 1
+	z.keys[2] = crc32Update(z.keys[2], byte(z.keys[1]>>24))
+}
+
+func (z *zipCrypto) decrypt(b []byte) {
+	for i := range b {
+		t := z.keys[2] | 2
+		b[i] ^= byte((t * (t ^ 1)) >> 8)
+		z.update(b[i])
+	}
+}
+
+// zipCryptoReader decrypts the traditional PKWARE encrypted stream
+type zipCryptoReader struct {
+	r io.Reader
+	z *zipCrypto
+}
+
+func (r *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.z.decrypt(p[:n])
+	return n, err
+}
+
+// newZipCryptoReader checks the password against the encryption header.
+func newZipCryptoReader(f *zip.File, raw io.Reader, header []byte, password string) (io.Reader, bool) {
+	z := newZipCrypto([]byte(password))
+	h := append([]byte{}, header...)
+	z.decrypt(h)
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&flagDataDescriptor != 0 {
+		// CRC isn't known when writing the header, the check byte comes from modification time
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if h[zipCryptoHeader-1] != check {
+		return nil, false
+	}
+	return &zipCryptoReader{r: raw, z: z}, true
+}
+
+// aesParams gives WinZip AES parameters found in the extra field
+func aesParams(f *zip.File) (version uint16, keyLen int, method uint16, err error) {
+	b, ok := extraField(f.Extra, aesExtraID)
+	if !ok || len(b) < 7 || b[2] != 'A' || b[3] != 'E' {
+		return 0, 0, 0, errors.New("Missing WinZip AES extra field")
+	}
+	version = binary.LittleEndian.Uint16(b)
+	switch b[4] {
+	case 1:
+		keyLen = 16
+	case 2:
+		keyLen = 24
+	case 3:
+		keyLen = 32
+	default:
+		return 0, 0, 0, errors.Errorf("Unknown AES strength %d", b[4])
+	}
+	method = binary.LittleEndian.Uint16(b[5:])
+	return version, keyLen, method, nil
+}
+
+// aesKeys derives encryption key, authentication key and password verification value
+func aesKeys(password string, salt []byte, keyLen int) (key, authKey, verifier []byte) {
+	k := pbkdf2.Key([]byte(password), salt, 1000, 2*keyLen+2, sha1.New)
+	return k[:keyLen], k[keyLen : 2*keyLen], k[2*keyLen:]
+}
+
+// winZipCTR is the AES counter mode used by WinZip: the counter is little endian
+// and starts at 1.
+type winZipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func newWinZipCTR(key []byte) (*winZipCTR, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &winZipCTR{block: block, used: aes.BlockSize}, nil
+}
+
+func (c *winZipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.used == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.used = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.used]
+		c.used++
+	}
+}
+
+// aesReader decrypts WinZip AES encrypted data and checks the authentication code at the end
+type aesReader struct {
+	data io.Reader // encrypted data
+	auth io.Reader // authentication code
+	ctr  *winZipCTR
+	mac  hash.Hash
+	done bool  // the authentication code is checked
+	err  error // result of the check, io.EOF when passed
+}
+
+func (r *aesReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, r.err
+	}
+	n, err := r.data.Read(p)
+	r.mac.Write(p[:n])
+	r.ctr.XORKeyStream(p[:n], p[:n])
+	if err == io.EOF {
+		r.done, r.err = true, r.check()
+		return n, r.err
+	}
+	return n, err
+}
+
+// check reads the authentication code and compares it to the computed one
+func (r *aesReader) check() error {
+	code := make([]byte, aesAuthLen)
+	if _, err := io.ReadFull(r.auth, code); err != nil {
+		return errors.Wrap(err, "Can't read AES authentication code")
+	}
+	if !hmac.Equal(code, r.mac.Sum(nil)[:aesAuthLen]) {
+		return errors.Wrap(zip.ErrChecksum, "AES authentication failed")
+	}
+	return io.EOF
+}
+
+// verify reads the remaining encrypted data and checks the authentication code
+func (r *aesReader) verify() error {
+	_, err := io.Copy(ioutil.Discard, r)
+	return err
+}
+
+// newAESReader checks the password against the verification value.
+func newAESReader(f *zip.File, raw io.Reader, salt, verifier []byte, keyLen int, password string) (*aesReader, bool) {
+	key, authKey, v := aesKeys(password, salt, keyLen)
+	if subtle.ConstantTimeCompare(v, verifier) != 1 {
+		return nil, false
+	}
+	ctr, err := newWinZipCTR(key)
+	if err != nil {
+		return nil, false
+	}
+	size := int64(f.CompressedSize64) - int64(len(salt)) - 2 - aesAuthLen
+	return &aesReader{
+		data: io.LimitReader(raw, size),
+		auth: raw,
+		ctr:  ctr,
+		mac:  hmac.New(sha1.New, authKey),
+	}, true
+}
+
+// authReader checks the AES authentication code once the content is read.
+// The decompressor stops before reaching the end of the encrypted data, so
+// the remaining is read for the check. A reader closed early isn't checked.
+type authReader struct {
+	io.ReadCloser
+	auth *aesReader
+}
+
+func (r *authReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		if aerr := r.auth.verify(); aerr != nil {
+			return n, aerr
+		}
+	}
+	return n, err
+}
+
+// checksumReader checks the CRC32 of the content at the end of the stream
+type checksumReader struct {
+	r    io.Reader
+	hash hash.Hash32
+	want uint32
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && r.hash.Sum32() != r.want {
+		return n, zip.ErrChecksum
+	}
+	return n, err
+}
+
+// passwordReader reports the decoding and checksum errors of encrypted
+// content as a wrong password: a wrong password passes the encryption header
+// check now and then.
+type passwordReader struct {
+	io.ReadCloser
+	path string
+}
+
+func (r *passwordReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if _, corrupted := errors.Cause(err).(flate.CorruptInputError); corrupted || errors.Cause(err) == zip.ErrChecksum {
+		err = &walker.Error{Path: r.path, Op: "decrypt", Err: walker.ErrPassword}
+	}
+	return n, err
+}
@@ -0,0 +1,231 @@
+package zipwalker
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/walker"
+)
+
+func TestZipCrypto(t *testing.T) {
+	cases := []struct {
+		opts []walker.Option
+		err  error
+	}{
+		{[]walker.Option{walker.Passwords("wrong", "secret")}, nil},
+		{[]walker.Option{walker.WithPasswordProvider(func(archive string) []string {
+			if filepath.Base(archive) == "zipcrypto.zip" {
+				return []string{"secret"}
+			}
+			return nil
+		})}, nil},
+		{[]walker.Option{walker.Passwords("wrong")}, walker.ErrPassword},
+		{nil, walker.ErrPassword},
+	}
+	for _, c := range cases {
+		checkEncrypted(t, "test/zipcrypto.zip", c.opts, c.err)
+	}
+}
+
+func TestZipAES(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "aes.zip")
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	writeAES(t, w, "file_a.txt", []byte("file_a.txt\n"), "secret", zip.Store, 3)
+	writeAES(t, w, "file_b.txt", []byte("file_b.txt\n"), "secret", zip.Deflate, 1)
+	w.Close()
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checkEncrypted(t, name, []walker.Option{walker.Passwords("wrong", "secret")}, nil)
+	checkEncrypted(t, name, []walker.Option{walker.Passwords("wrong")}, walker.ErrPassword)
+
+	// Tampered data are detected
+	b := buf.Bytes()
+	b[bytes.Index(b, []byte("file_a.txt"))+len("file_a.txt")+11+16+2+5] ^= 0xff // within encrypted data, after salt and verifier
+	if err := ioutil.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	item, err := walker.OpenPath(filepath.Join(name, "file_a.txt"), walker.Passwords("secret"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer item.Close()
+	r, err := item.RawReader()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if _, err = ioutil.ReadAll(r); errors.Cause(err) != walker.ErrPassword {
+		t.Errorf("Expected password error, but got %v", err)
+	}
+}
+
+func TestZipAESFixture(t *testing.T) {
+	const name = "test/macbeth-act1.zip/macbeth-act1.txt"
+	for _, passwords := range [][]string{{"golang"}, {"wrong", "golang"}} {
+		item, err := walker.OpenPath(name, walker.Passwords(passwords...))
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		r, err := item.RawReader()
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		content, err := ioutil.ReadAll(r)
+		if err != nil || len(content) != 23124 || !bytes.Contains(content, []byte("Exeunt")) {
+			t.Errorf("Expected the act to be read, but got %d bytes, %v", len(content), err)
+		}
+		item.Close()
+	}
+}
+
+func TestZipAESAuthentication(t *testing.T) {
+	b, err := ioutil.ReadFile("test/macbeth-act1.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, err := zr.File[0].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[offset+int64(zr.File[0].CompressedSize64)-1] ^= 0xff // last byte of the authentication code
+	name := filepath.Join(t.TempDir(), "macbeth-act1.zip")
+	if err := ioutil.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := walker.OpenPath(filepath.Join(name, "macbeth-act1.txt"), walker.Passwords("golang"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer item.Close()
+	r, err := item.RawReader()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if _, err = ioutil.ReadAll(r); errors.Cause(err) != walker.ErrPassword {
+		t.Errorf("Expected password error at the end of the content, but got %v", err)
+	}
+
+	// A reader closed early isn't checked
+	rc, err := item.Open()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	rc.Read(make([]byte, 10))
+	if err = rc.Close(); err != nil {
+		t.Errorf("Unexpected error when closing %s", err)
+	}
+}
+
+func TestZipCryptoFalsePassword(t *testing.T) {
+	zr, err := zip.OpenReader("test/zipcrypto.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	f := zr.File[0]
+	raw, err := f.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, zipCryptoHeader)
+	raw.Read(header)
+	// Find a wrong password passing the one byte check of the first member
+	fake := ""
+	for n := 0; fake == ""; n++ {
+		if p := fmt.Sprintf("fake%d", n); p != "secret" {
+			if _, ok := newZipCryptoReader(f, raw, header, p); ok {
+				fake = p
+			}
+		}
+	}
+	checkEncrypted(t, "test/zipcrypto.zip", []walker.Option{walker.Passwords(fake, "secret")}, nil)
+}
+
+func checkEncrypted(t *testing.T, name string, opts []walker.Option, expected error) {
+	z, err := Open(name, opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer z.Close()
+	count := 0
+	for item := range z.Items() {
+		count++
+		if !item.Meta()[walker.MetaEncrypted].(bool) {
+			t.Errorf("Expected '%s' to be encrypted", item.Name())
+		}
+		r, err := item.RawReader()
+		if expected != nil {
+			if e, ok := err.(*walker.Error); !ok || e.Err != expected {
+				t.Errorf("Expected error %v for '%s', but got %v", expected, item.Name(), err)
+			}
+			item.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		content, err := ioutil.ReadAll(r)
+		if err != nil || string(content) != item.Name()+"\n" {
+			t.Errorf("Expected content of '%s' to be '%s', but got '%s', %v", item.Name(), item.Name(), content, err)
+		}
+		item.Close()
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 items, but got %d", count)
+	}
+}
+
+// writeAES adds a WinZip AE-2 encrypted member to the archive
+func writeAES(t *testing.T, w *zip.Writer, name string, content []byte, password string, method uint16, strength byte) {
+	keyLen := 8 + 8*int(strength)
+	data := content
+	if method == zip.Deflate {
+		b := new(bytes.Buffer)
+		fw, _ := flate.NewWriter(b, flate.BestCompression)
+		fw.Write(content)
+		fw.Close()
+		data = b.Bytes()
+	}
+	salt := make([]byte, keyLen/2)
+	rand.Read(salt)
+	key, authKey, verifier := aesKeys(password, salt, keyLen)
+	ctr, err := newWinZipCTR(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := make([]byte, len(data))
+	ctr.XORKeyStream(encrypted, data)
+	mac := hmac.New(sha1.New, authKey)
+	mac.Write(encrypted)
+
+	raw := append(append(append(salt, verifier...), encrypted...), mac.Sum(nil)[:aesAuthLen]...)
+	h := &zip.FileHeader{
+		Name:               name,
+		Method:             methodAES,
+		Flags:              flagEncrypted,
+		CompressedSize64:   uint64(len(raw)),
+		UncompressedSize64: uint64(len(content)),
+		Extra:              []byte{0x01, 0x99, 7, 0, 2, 0, 'A', 'E', strength, byte(method), byte(method >> 8)},
+	}
+	f, err := w.CreateRaw(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(raw)
+}
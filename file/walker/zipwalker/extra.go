@@ -0,0 +1,48 @@
+package zipwalker
+
+import "encoding/binary"
+
+// Extra field identifiers
+const (
+	unixOwnerID = 0x7875 // Info-ZIP new unix extra field
+)
+
+// extraField gives the data of the extra field with the given id
+func extraField(extra []byte, id uint16) ([]byte, bool) {
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			return nil, false
+		}
+		if tag == id {
+			return extra[:size], true
+		}
+		extra = extra[size:]
+	}
+	return nil, false
+}
+
+// unixOwner decodes uid and gid from Info-ZIP new unix extra field
+func unixOwner(extra []byte) (uid, gid int, ok bool) {
+	b, ok := extraField(extra, unixOwnerID)
+	if !ok || len(b) < 2 || b[0] != 1 {
+		return 0, 0, false
+	}
+	b = b[1:]
+	var ids [2]int
+	for n := range ids {
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return 0, 0, false
+		}
+		size := int(b[0])
+		var v uint64
+		for i := size - 1; i >= 0; i-- {
+			v = v<<8 | uint64(b[1+i])
+		}
+		ids[n] = int(v)
+		b = b[1+size:]
+	}
+	return ids[0], ids[1], true
+}
@@ -19,3 +19,15 @@ popd
 pushd tree
 zip -rm ../zip/tree.zip *
 popd
+
+# Encrypted archive, the password is "secret"
+mkdir crypto
+for f in file_{a,b}.txt; do echo $f > ./crypto/$f; done;
+pushd crypto
+zip -rm -P secret ../zip/zipcrypto.zip *
+popd
+rmdir crypto
+
+# test/macbeth-act1.zip is a WinZip AE-2 AES-256 deflated archive made by a
+# third party tool, taken from github.com/alexmullins/zip testdata (MIT
+# license). The password is "golang".
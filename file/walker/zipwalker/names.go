@@ -0,0 +1,72 @@
+package zipwalker
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/simulot/golib/file/walker"
+	textencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	flagUTF8           = 0x800  // General purpose flag: name and comment are UTF-8
+	unicodePathExtraID = 0x7075 // Info-ZIP Unicode path extra field
+)
+
+// decodeNames converts member names into UTF-8. The Info-ZIP Unicode path is
+// used when present and still matching the name. Names that aren't flagged as
+// UTF-8 and aren't valid UTF-8 are decoded with the given encoding, IBM code
+// page 437 by default.
+func decodeNames(files []*zip.File, enc textencoding.Encoding) {
+	if enc == nil {
+		enc = charmap.CodePage437
+	}
+	for _, f := range files {
+		if name, ok := unicodePath(f); ok {
+			f.Name = name
+			f.NonUTF8 = false
+			continue
+		}
+		if f.Flags&flagUTF8 != 0 || utf8.ValidString(f.Name) {
+			continue
+		}
+		if name, err := enc.NewDecoder().String(f.Name); err == nil {
+			f.Name = name
+			f.NonUTF8 = false
+		}
+	}
+}
+
+// cleanNames makes entry names relative paths that can't escape the archive,
+// and drops entries of the archive root
+func cleanNames(files []*zip.File) []*zip.File {
+	kept := files[:0]
+	for _, f := range files {
+		f.Name = walker.CleanName(f.Name, strings.HasSuffix(f.Name, "/"))
+		if f.Name != "" {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// unicodePath gives the name stored in the Info-ZIP Unicode path extra field.
+// The field is ignored when the name has been changed by a tool unaware of it.
+func unicodePath(f *zip.File) (string, bool) {
+	b, ok := extraField(f.Extra, unicodePathExtraID)
+	if !ok || len(b) < 5 || b[0] != 1 {
+		return "", false
+	}
+	if binary.LittleEndian.Uint32(b[1:]) != crc32.ChecksumIEEE([]byte(f.Name)) {
+		return "", false
+	}
+	name := string(b[5:])
+	if !utf8.ValidString(name) {
+		return "", false
+	}
+	return name, true
+}
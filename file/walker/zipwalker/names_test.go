@@ -0,0 +1,63 @@
+package zipwalker
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	textencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// unicodePathExtra builds an Info-ZIP Unicode path extra field
+func unicodePathExtra(raw, name string) []byte {
+	b := make([]byte, 9, 9+len(name))
+	binary.LittleEndian.PutUint16(b, unicodePathExtraID)
+	binary.LittleEndian.PutUint16(b[2:], uint16(5+len(name)))
+	b[4] = 1
+	binary.LittleEndian.PutUint32(b[5:], crc32.ChecksumIEEE([]byte(raw)))
+	return append(b, name...)
+}
+
+func TestDecodeNames(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	headers := []*zip.FileHeader{
+		{Name: "caf\x82.txt", NonUTF8: true},
+		{Name: "\x9b.txt", NonUTF8: true},
+		{Name: "été.txt"},
+		{Name: "ascii.txt"},
+		{Name: "na\x8bve.txt", NonUTF8: true, Extra: unicodePathExtra("na\x8bve.txt", "naïve.txt")},
+		{Name: "stale\x82.txt", NonUTF8: true, Extra: unicodePathExtra("renamed", "ignored.txt")},
+	}
+	for _, h := range headers {
+		if _, err := w.CreateHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name string
+		enc  textencoding.Encoding
+		want []string
+	}{
+		{"default", nil, []string{"café.txt", "¢.txt", "été.txt", "ascii.txt", "naïve.txt", "staleé.txt"}},
+		{"cp850", charmap.CodePage850, []string{"café.txt", "ø.txt", "été.txt", "ascii.txt", "naïve.txt", "staleé.txt"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := mustZipReader(t, buf.Bytes())
+			decodeNames(r.File, tc.enc)
+			for i, f := range r.File {
+				if f.Name != tc.want[i] {
+					t.Errorf("Expecting name %q, got %q", tc.want[i], f.Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,416 @@
+package zipwalker
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Record signatures
+const (
+	localHeaderSig      = 0x04034b50
+	centralHeaderSig    = 0x02014b50
+	dataDescriptorSig   = 0x08074b50
+	directoryEndSig     = 0x06054b50
+	directory64EndSig   = 0x06064b50
+	directory64LocSig   = 0x07064b50
+	localHeaderLen      = 30
+	zip64ExtraID        = 0x0001
+	recoverScanChunkLen = 64 << 10
+)
+
+// recovered is an entry found by scanning local file headers
+type recovered struct {
+	version          uint16
+	flags            uint16
+	method           uint16
+	time, date       uint16
+	crc32            uint32
+	compressedSize   uint64
+	uncompressedSize uint64
+	name             []byte
+	extra            []byte // local extra fields, without ZIP64 one
+	offset           int64  // local header offset
+}
+
+// recoverArchive salvages entries of an archive with a damaged or missing central
+// directory. Local file headers are scanned, and a new central directory is
+// appended virtually to the archive.
+func recoverArchive(r io.ReaderAt, size int64) (*zip.Reader, error) {
+	entries := []recovered{}
+	s := newScanner(r, size)
+	for offset := int64(0); offset < size; {
+		offset = s.find(offset, localHeaderSig)
+		if offset < 0 {
+			break
+		}
+		e, next, err := readLocalEntry(r, offset, size, s)
+		if err != nil {
+			// Not a real header, or a truncated entry
+			offset++
+			continue
+		}
+		entries = append(entries, e)
+		offset = next
+	}
+	if len(entries) == 0 {
+		return nil, errors.Wrap(zip.ErrFormat, "No entry recovered")
+	}
+	directory := centralDirectory(entries, size)
+	return zip.NewReader(&appendedReaderAt{r: r, size: size, tail: directory}, size+int64(len(directory)))
+}
+
+// scanner finds record signatures. The archive is read by chunks into one
+// buffer, kept between searches: successive searches moving forward read the
+// archive once.
+type scanner struct {
+	r    io.ReaderAt
+	size int64
+	buf  []byte
+	base int64 // offset of buf[0] in the archive
+	n    int   // bytes of buf read from the archive
+}
+
+func newScanner(r io.ReaderAt, size int64) *scanner {
+	return &scanner{r: r, size: size, buf: make([]byte, recoverScanChunkLen)}
+}
+
+// find gives the offset of the next signature from offset, or -1
+func (s *scanner) find(offset int64, sig uint32) int64 {
+	pattern := make([]byte, 4)
+	binary.LittleEndian.PutUint32(pattern, sig)
+	for offset < s.size {
+		if offset < s.base || offset+int64(len(pattern)) > s.base+int64(s.n) {
+			n, _ := s.r.ReadAt(s.buf, offset)
+			s.base, s.n = offset, n
+			if n < len(pattern) {
+				return -1
+			}
+		}
+		if i := bytes.Index(s.buf[offset-s.base:s.n], pattern); i >= 0 {
+			return offset + int64(i)
+		}
+		if s.n < len(s.buf) {
+			// The chunk ends with the archive, or with a read error
+			return -1
+		}
+		offset = s.base + int64(s.n-len(pattern)+1)
+	}
+	return -1
+}
+
+// readLocalEntry decodes the local header at offset and finds where the entry ends.
+// The scanner searches data descriptors.
+func readLocalEntry(r io.ReaderAt, offset, size int64, s *scanner) (recovered, int64, error) {
+	var e recovered
+	h := make([]byte, localHeaderLen)
+	if _, err := r.ReadAt(h, offset); err != nil {
+		return e, 0, err
+	}
+	b := readBuf(h[4:])
+	e.version = b.uint16()
+	e.flags = b.uint16()
+	e.method = b.uint16()
+	e.time = b.uint16()
+	e.date = b.uint16()
+	e.crc32 = b.uint32()
+	e.compressedSize = uint64(b.uint32())
+	e.uncompressedSize = uint64(b.uint32())
+	nameLen := int64(b.uint16())
+	extraLen := int64(b.uint16())
+	e.offset = offset
+
+	dataOffset := offset + localHeaderLen + nameLen + extraLen
+	if dataOffset > size {
+		return e, 0, io.ErrUnexpectedEOF
+	}
+	v := make([]byte, nameLen+extraLen)
+	if _, err := r.ReadAt(v, offset+localHeaderLen); err != nil {
+		return e, 0, err
+	}
+	e.name = v[:nameLen]
+	extra := v[nameLen:]
+	z64, zip64 := extraField(extra, zip64ExtraID)
+	if zip64 {
+		z := readBuf(z64)
+		if e.uncompressedSize == math.MaxUint32 && len(z) >= 8 {
+			e.uncompressedSize = z.uint64()
+		}
+		if e.compressedSize == math.MaxUint32 && len(z) >= 8 {
+			e.compressedSize = z.uint64()
+		}
+	}
+	e.extra = removeExtraField(extra, zip64ExtraID)
+
+	if e.flags&flagDataDescriptor == 0 {
+		end := dataOffset + int64(e.compressedSize)
+		if end > size {
+			return e, 0, io.ErrUnexpectedEOF
+		}
+		return e, end, nil
+	}
+
+	// Sizes and CRC follow the data
+	var dataLen int64
+	if e.method == zip.Deflate && e.flags&flagEncrypted == 0 {
+		n, err := deflatedLen(io.NewSectionReader(r, dataOffset, size-dataOffset))
+		if err != nil {
+			return e, 0, err
+		}
+		dataLen = n
+	} else {
+		// Search the descriptor that matches the data length
+		d := make([]byte, 12)
+		for from := dataOffset; ; from++ {
+			from = s.find(from, dataDescriptorSig)
+			if from < 0 {
+				return e, 0, io.ErrUnexpectedEOF
+			}
+			if _, err := r.ReadAt(d, from+4); err != nil {
+				return e, 0, err
+			}
+			if binary.LittleEndian.Uint32(d[4:]) == uint32(from-dataOffset) {
+				dataLen = from - dataOffset
+				break
+			}
+		}
+	}
+	return readDataDescriptor(r, e, dataOffset+dataLen, zip64 || dataLen >= math.MaxUint32)
+}
+
+// readDataDescriptor reads sizes and CRC following entry data at offset.
+// Sizes are 8 bytes long for ZIP64 entries.
+func readDataDescriptor(r io.ReaderAt, e recovered, offset int64, zip64 bool) (recovered, int64, error) {
+	d := make([]byte, 24)
+	n, _ := r.ReadAt(d, offset)
+	d = d[:n]
+	if len(d) >= 4 && binary.LittleEndian.Uint32(d) == dataDescriptorSig {
+		d = d[4:]
+		offset += 4
+	}
+	if len(d) < 12 {
+		return e, 0, io.ErrUnexpectedEOF
+	}
+	b := readBuf(d)
+	e.crc32 = b.uint32()
+	if zip64 {
+		if len(d) < 20 {
+			return e, 0, io.ErrUnexpectedEOF
+		}
+		e.compressedSize = b.uint64()
+		e.uncompressedSize = b.uint64()
+		return e, offset + 20, nil
+	}
+	e.compressedSize = uint64(b.uint32())
+	e.uncompressedSize = uint64(b.uint32())
+	return e, offset + 12, nil
+}
+
+// byteCounter counts bytes consumed by the decompressor
+type byteCounter struct {
+	*bufio.Reader
+	n int64
+}
+
+func (c *byteCounter) ReadByte() (byte, error) {
+	b, err := c.Reader.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// deflatedLen gives the length of the deflated stream by inflating it
+func deflatedLen(r io.Reader) (int64, error) {
+	c := &byteCounter{Reader: bufio.NewReader(r)}
+	f := flate.NewReader(c)
+	if _, err := io.Copy(ioutil.Discard, f); err != nil {
+		return 0, err
+	}
+	return c.n, nil
+}
+
+// removeExtraField gives the extra fields without the given one
+func removeExtraField(extra []byte, id uint16) []byte {
+	out := []byte{}
+	for len(extra) >= 4 {
+		size := 4 + int(binary.LittleEndian.Uint16(extra[2:]))
+		if size > len(extra) {
+			break
+		}
+		if binary.LittleEndian.Uint16(extra) != id {
+			out = append(out, extra[:size]...)
+		}
+		extra = extra[size:]
+	}
+	return out
+}
+
+// centralDirectory builds the central directory of recovered entries,
+// located at offset. ZIP64 records are used when needed.
+func centralDirectory(entries []recovered, offset int64) []byte {
+	buf := new(bytes.Buffer)
+	w := writeBuf{buf}
+	for _, e := range entries {
+		z64 := new(bytes.Buffer)
+		zw := writeBuf{z64}
+		compressedSize, uncompressedSize, headerOffset := uint32(e.compressedSize), uint32(e.uncompressedSize), uint32(e.offset)
+		if e.uncompressedSize >= math.MaxUint32 {
+			uncompressedSize = math.MaxUint32
+			zw.uint64(e.uncompressedSize)
+		}
+		if e.compressedSize >= math.MaxUint32 {
+			compressedSize = math.MaxUint32
+			zw.uint64(e.compressedSize)
+		}
+		if e.offset >= math.MaxUint32 {
+			headerOffset = math.MaxUint32
+			zw.uint64(uint64(e.offset))
+		}
+		extra := e.extra
+		if z64.Len() > 0 {
+			f := new(bytes.Buffer)
+			fw := writeBuf{f}
+			fw.uint16(zip64ExtraID)
+			fw.uint16(uint16(z64.Len()))
+			f.Write(z64.Bytes())
+			extra = append(f.Bytes(), extra...)
+		}
+		w.uint32(centralHeaderSig)
+		w.uint16(e.version) // made by FAT
+		w.uint16(e.version)
+		w.uint16(e.flags)
+		w.uint16(e.method)
+		w.uint16(e.time)
+		w.uint16(e.date)
+		w.uint32(e.crc32)
+		w.uint32(compressedSize)
+		w.uint32(uncompressedSize)
+		w.uint16(uint16(len(e.name)))
+		w.uint16(uint16(len(extra)))
+		w.uint16(0) // comment length
+		w.uint16(0) // disk number
+		w.uint16(0) // internal attributes
+		w.uint32(0) // external attributes
+		w.uint32(headerOffset)
+		buf.Write(e.name)
+		buf.Write(extra)
+	}
+
+	size := int64(buf.Len())
+	count := len(entries)
+	if count >= math.MaxUint16 || offset >= math.MaxUint32 || size >= math.MaxUint32 {
+		end64 := offset + size
+		w.uint32(directory64EndSig)
+		w.uint64(44) // record size
+		w.uint16(45) // made by
+		w.uint16(45) // needed
+		w.uint32(0)  // disk number
+		w.uint32(0)  // directory disk
+		w.uint64(uint64(count))
+		w.uint64(uint64(count))
+		w.uint64(uint64(size))
+		w.uint64(uint64(offset))
+		w.uint32(directory64LocSig)
+		w.uint32(0) // disk
+		w.uint64(uint64(end64))
+		w.uint32(1) // total disks
+		count = math.MaxUint16
+		size = math.MaxUint32
+		offset = math.MaxUint32
+	}
+	w.uint32(directoryEndSig)
+	w.uint16(0) // disk number
+	w.uint16(0) // directory disk
+	w.uint16(uint16(count))
+	w.uint16(uint16(count))
+	w.uint32(uint32(size))
+	w.uint32(uint32(offset))
+	w.uint16(0) // comment length
+	return buf.Bytes()
+}
+
+// appendedReaderAt reads the archive followed by tail bytes
+type appendedReaderAt struct {
+	r    io.ReaderAt
+	size int64
+	tail []byte
+}
+
+func (a *appendedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < a.size {
+		l := p
+		if int64(len(l)) > a.size-off {
+			l = l[:a.size-off]
+		}
+		m, err := a.r.ReadAt(l, off)
+		n += m
+		if m < len(l) {
+			return n, err
+		}
+		off += int64(m)
+	}
+	if n == len(p) {
+		return n, nil
+	}
+	t := off - a.size
+	if t >= int64(len(a.tail)) {
+		return n, io.EOF
+	}
+	m := copy(p[n:], a.tail[t:])
+	n += m
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+type readBuf []byte
+
+func (b *readBuf) uint16() uint16 {
+	v := binary.LittleEndian.Uint16(*b)
+	*b = (*b)[2:]
+	return v
+}
+
+func (b *readBuf) uint32() uint32 {
+	v := binary.LittleEndian.Uint32(*b)
+	*b = (*b)[4:]
+	return v
+}
+
+func (b *readBuf) uint64() uint64 {
+	v := binary.LittleEndian.Uint64(*b)
+	*b = (*b)[8:]
+	return v
+}
+
+type writeBuf struct {
+	*bytes.Buffer
+}
+
+func (w writeBuf) uint16(v uint16) {
+	binary.Write(w.Buffer, binary.LittleEndian, v)
+}
+
+func (w writeBuf) uint32(v uint32) {
+	binary.Write(w.Buffer, binary.LittleEndian, v)
+}
+
+func (w writeBuf) uint64(v uint64) {
+	binary.Write(w.Buffer, binary.LittleEndian, v)
+}
@@ -0,0 +1,160 @@
+package zipwalker
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/simulot/golib/file/walker"
+)
+
+// directoryOffset gives the offset of the central directory
+func directoryOffset(b []byte) int {
+	return bytes.Index(b, []byte("PK\x01\x02"))
+}
+
+// damagedZip writes an archive cut at the given length and returns its path
+func damagedZip(t *testing.T, b []byte, length int) string {
+	path := filepath.Join(t.TempDir(), "damaged.zip")
+	if err := ioutil.WriteFile(path, b[:length], 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRecover(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	content := map[string]string{}
+	for i, method := range []uint16{zip.Deflate, zip.Store, zip.Deflate} {
+		name := fmt.Sprintf("dir/file_%d.txt", i)
+		content[name] = fmt.Sprintf("Content of %s, %s", name, bytes.Repeat([]byte{'x'}, 100*i))
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content[name]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	directory := directoryOffset(buf.Bytes())
+
+	tcs := []struct {
+		name   string
+		length int
+		want   int
+	}{
+		{"no central directory", directory, 3},
+		{"truncated central directory", directory + 20, 3},
+		{"truncated member", directory - 10, 2},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			path := damagedZip(t, buf.Bytes(), tc.length)
+			if _, err := Open(path); err == nil {
+				t.Fatal("Expecting an error without Recover option")
+			}
+			z, err := Open(path, walker.Recover())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer z.Close()
+			got := 0
+			for item := range z.Items() {
+				r, err := item.RawReader()
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := ioutil.ReadAll(r)
+				if err != nil {
+					t.Fatalf("Can't read %s: %s", item.MemberName(), err)
+				}
+				name, _ := walker.ArchiveName(item)
+				if string(b) != content[name] {
+					t.Errorf("Unexpected content for %s: %q", name, b)
+				}
+				item.Close()
+				got++
+			}
+			if got != tc.want {
+				t.Errorf("Expecting %d items, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRecoverZip64(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping archive with many entries in short mode")
+	}
+	// More than 65535 entries need ZIP64 end of central directory records
+	const count = 1 << 16
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for i := 0; i < count; i++ {
+		if _, err := w.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("%05d", i), Method: zip.Store}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	directory := directoryOffset(buf.Bytes())
+
+	for _, length := range []int{buf.Len(), directory} {
+		path := damagedZip(t, buf.Bytes(), length)
+		z, err := Open(path, walker.Recover())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := 0
+		for item := range z.Items() {
+			item.Close()
+			got++
+		}
+		z.Close()
+		if got != count {
+			t.Errorf("Expecting %d items, got %d", count, got)
+		}
+	}
+}
+
+// countingReaderAt counts bytes read
+type countingReaderAt struct {
+	*bytes.Reader
+	n int
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	r.n += n
+	return n, err
+}
+
+func TestScanner(t *testing.T) {
+	sig := []byte("PK\x07\x08")
+	b := make([]byte, 3*recoverScanChunkLen)
+	offsets := []int64{10, recoverScanChunkLen - 2, recoverScanChunkLen + 5, int64(len(b)) - 4}
+	for _, o := range offsets {
+		copy(b[o:], sig)
+	}
+	r := &countingReaderAt{Reader: bytes.NewReader(b)}
+	s := newScanner(r, int64(len(b)))
+	found := []int64{}
+	for from := int64(0); ; from++ {
+		if from = s.find(from, dataDescriptorSig); from < 0 {
+			break
+		}
+		found = append(found, from)
+	}
+	if fmt.Sprint(found) != fmt.Sprint(offsets) {
+		t.Errorf("Expected signatures at %v, but got %v", offsets, found)
+	}
+	if r.n > len(b)+16 {
+		t.Errorf("Expected the archive to be read once, but %d bytes were read for %d", r.n, len(b))
+	}
+}
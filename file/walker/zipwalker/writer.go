@@ -0,0 +1,122 @@
+package zipwalker
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/walker"
+)
+
+// Writer writes walker items into a zip archive.
+// ZIP64 records are written by archive/zip as soon as an entry or the
+// archive exceeds 4GB, or has more than 65535 entries. There is no option to
+// force them: archive/zip doesn't offer one, and smaller archives are kept
+// readable by tools that don't know ZIP64.
+type Writer struct {
+	zw     *zip.Writer
+	method uint16
+}
+
+// WriterOption is a functional option for NewWriter
+type WriterOption func(*Writer)
+
+// CompressionLevel set the deflate compression level, from flate.NoCompression to
+// flate.BestCompression. With flate.NoCompression, items are stored.
+func CompressionLevel(level int) WriterOption {
+	return func(w *Writer) {
+		if level == flate.NoCompression {
+			w.method = zip.Store
+			return
+		}
+		w.zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	}
+}
+
+// NewWriter creates a zip archive on w.
+func NewWriter(w io.Writer, opts ...WriterOption) *Writer {
+	zw := &Writer{
+		zw:     zip.NewWriter(w),
+		method: zip.Deflate,
+	}
+	for _, opt := range opts {
+		opt(zw)
+	}
+	return zw
+}
+
+// Write adds the item to the archive with its member name, modification time and
+// permissions. Symbolic links are written as their target. The item isn't closed.
+func (w *Writer) Write(item walker.WalkItem) error {
+	info, err := walker.ArchiveInfo(item)
+	if err != nil {
+		return err
+	}
+	f, err := w.Create(item)
+	if err != nil || info.IsDir() {
+		return err
+	}
+	r, err := item.RawReader()
+	if err != nil {
+		return errors.Wrapf(err, "Can't read '%s'", item.FullName())
+	}
+	_, err = io.Copy(f, r)
+	return errors.Wrapf(err, "Can't write '%s' into zip", item.FullName())
+}
+
+// Create adds the item header to the archive, like Write, and gives the writer
+// of the member content. The content must be written before the next call to
+// Write or Create. Directories have no content.
+func (w *Writer) Create(item walker.WalkItem) (io.Writer, error) {
+	name, err := walker.ArchiveName(item)
+	if err != nil {
+		return nil, err
+	}
+	return w.CreateAs(item, name)
+}
+
+// CreateAs adds the item header to the archive under the slash separated
+// name, and gives the writer of the member content, like Create.
+func (w *Writer) CreateAs(item walker.WalkItem, name string) (io.Writer, error) {
+	info, err := walker.ArchiveInfo(item)
+	if err != nil {
+		return nil, err
+	}
+	h, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can't make zip header for '%s'", item.FullName())
+	}
+	h.Name = name
+	h.Method = w.method
+	if info.IsDir() {
+		h.Name += "/"
+		h.Method = zip.Store
+	}
+	f, err := w.zw.CreateHeader(h)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can't write '%s' into zip", item.FullName())
+	}
+	return f, nil
+}
+
+// WriteAll writes all items of the channel into the archive, and close them.
+// It stops writing at first error, but the channel is drained.
+func (w *Writer) WriteAll(items chan walker.WalkItem) error {
+	var err error
+	for item := range items {
+		if err == nil {
+			err = w.Write(item)
+		}
+		item.Close()
+	}
+	return err
+}
+
+// Close finishes the archive by writing the central directory.
+// The underlying writer isn't closed.
+func (w *Writer) Close() error {
+	return w.zw.Close()
+}
@@ -0,0 +1,162 @@
+package zipwalker
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/simulot/golib/file/walker"
+)
+
+func TestWriter(t *testing.T) {
+	for _, level := range []int{flate.NoCompression, flate.BestCompression} {
+		source, err := Open("test/tree.zip", walker.Dirs(walker.DirsPreOrder))
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf, CompressionLevel(level))
+		if err = w.WriteAll(source.Items()); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		source.Close()
+
+		original, err := zip.OpenReader("test/tree.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]*zip.File{}
+		for _, f := range original.File {
+			expected[f.Name] = f
+		}
+
+		got := []string{}
+		for _, f := range mustZipReader(t, buf.Bytes()).File {
+			got = append(got, f.Name)
+			o, ok := expected[f.Name]
+			if !ok {
+				t.Errorf("Unexpected member '%s'", f.Name)
+				continue
+			}
+			if !f.Modified.Equal(o.Modified) {
+				t.Errorf("Expected '%s' modification time to be %s, but got %s", f.Name, o.Modified, f.Modified)
+			}
+			if f.Mode() != o.Mode() {
+				t.Errorf("Expected '%s' mode to be %s, but got %s", f.Name, o.Mode(), f.Mode())
+			}
+			if level == flate.NoCompression && f.Method != zip.Store {
+				t.Errorf("Expected '%s' to be stored, but got method %d", f.Name, f.Method)
+			}
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if got, expected := readZipFile(t, f), readZipFile(t, o); !bytes.Equal(got, expected) {
+				t.Errorf("Expected '%s' content to be '%s', but got '%s'", f.Name, expected, got)
+			}
+		}
+		original.Close()
+		if len(got) != len(expected) {
+			t.Errorf("Expected %d members, but got %#q", len(expected), got)
+		}
+	}
+}
+
+func TestWriterFromFolder(t *testing.T) {
+	source, err := walker.Open("../test/tree")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	if err = w.WriteAll(source.Items()); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	w.Close()
+	got := []string{}
+	for _, f := range mustZipReader(t, buf.Bytes()).File {
+		got = append(got, f.Name)
+	}
+	expected := []string{"test/tree/file_a.txt", "test/tree/file_b.txt", "test/tree/file_c.txt", "test/tree/subtree/file_d.txt", "test/tree/subtree/file_e.txt", "test/tree/subtree/file_f.txt"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %#q, but got %#q", expected, got)
+	}
+}
+
+func TestWriterCreate(t *testing.T) {
+	source, err := walker.Open("../test/tree")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for item := range source.Items() {
+		f, err := w.Create(item)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if _, err = f.Write([]byte(item.Name())); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		item.Close()
+	}
+	w.Close()
+	source.Close()
+	for _, f := range mustZipReader(t, buf.Bytes()).File {
+		if got, expected := string(readZipFile(t, f)), path.Base(f.Name); got != expected {
+			t.Errorf("Expected '%s' content to be '%s', but got '%s'", f.Name, expected, got)
+		}
+	}
+}
+
+func readZipFile(t *testing.T, f *zip.File) []byte {
+	r, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestWriterSymlink(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a.txt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link.txt")); err != nil {
+		t.Skip(err)
+	}
+	source, err := walker.Open(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	if err = w.WriteAll(source.Items()); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	w.Close()
+	source.Close()
+	got := map[string]string{}
+	for _, f := range mustZipReader(t, buf.Bytes()).File {
+		if !f.Mode().IsRegular() {
+			t.Errorf("Expected '%s' to be a regular file, but got %s", f.Name, f.Mode())
+		}
+		got[path.Base(f.Name)] = string(readZipFile(t, f))
+	}
+	if expected := map[string]string{"a.txt": "a.txt\n", "link.txt": "a.txt\n"}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %q, but got %q", expected, got)
+	}
+}
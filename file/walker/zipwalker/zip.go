@@ -2,11 +2,13 @@ package zipwalker
 
 import (
 	"archive/zip"
+	"compress/flate"
+	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/simulot/golib/file/walker"
@@ -14,124 +16,225 @@ import (
 
 // init registers zip walker into walkers.
 func init() {
-	walker.Register(Open, Matcher)
+	walker.RegisterFormat(walker.Format{
+		Name:     "zip",
+		Opener:   Open,
+		Matcher:  Matcher,
+		Detector: Detector,
+	})
 }
 
-// Matcher returns true when the name is like .zip. Used to recognize
-// the kind of Walker to be open.
+// Extensions of zip archives, including documents made of a zip archive
+var Extensions = []string{".zip", ".jar", ".apk", ".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp", ".epub"}
+
+// Matcher returns true when the name is like .zip, or a document stored as
+// a zip archive, like .docx or .jar. Used to recognize the kind of Walker to be open.
 func Matcher(name string) bool {
-	return strings.ToLower(filepath.Ext(name)) == ".zip"
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
 }
 
+// Detector returns true when the header starts with the zip signature.
+var Detector = walker.Magic(0, "PK\x03\x04", "PK\x05\x06")
+
 // Zip handles zip archive as a Walker. This provide a common way
 // to walk through the ZIP content, opening, closing ZIP items.
 type Zip struct {
-	path    string          // archive path
-	archive *zip.ReadCloser // Zip reader
-	wg      sync.WaitGroup  // Keep track of entry file references, prevent closing Zip before all references are done or closed
+	*walker.Archive
+	file    *os.File        // archive file
+	keyring *walker.Keyring // candidate passwords
 }
 
-// Open opens a ZIP archive at path.
-func Open(path string) (walker.Walker, error) {
-	archive, err := zip.OpenReader(path)
+// Open opens a ZIP archive at path. ZIP64 archives are supported.
+// With the walker.Recover option, entries of an archive with a damaged
+// central directory are salvaged from local file headers.
+func Open(path string, opts ...walker.Option) (walker.Walker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't open Zip")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "Can't open Zip")
+	}
+	options := walker.NewOptions(opts...)
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil && options.Recover {
+		options.Logger.Info("Recovering archive", "file", path, "error", err)
+		archive, err = recoverArchive(file, info.Size())
+	}
 	if err != nil {
+		file.Close()
 		return nil, errors.Wrap(err, "Can't open Zip")
 	}
+	decodeNames(archive.File, options.NameEncoding)
+	archive.File = cleanNames(archive.File)
+	members := make([]*walker.Member, len(archive.File))
+	for n, f := range archive.File {
+		members[n] = &walker.Member{Name: f.Name, Info: f.FileInfo(), Header: f, Index: n}
+	}
 	z := &Zip{
-		path:    path,
-		archive: archive,
+		file:    file,
+		keyring: walker.NewKeyring(path, options),
 	}
+	z.Archive = walker.NewArchive(path, members, z, file.Close, options)
 	return z, nil
 }
 
-// Close the Zipped archive.
-// It returns immediately but creates a goroutine that waits closing of
-// all ZIP items. Then the ZIP archive itself is close.
-func (z *Zip) Close() {
-	go func() {
-		// Wait that all zip items have been released using Close()
-		z.wg.Wait()
-		z.archive.Close()
-	}()
+// OpenMember gives a reader on the member content, decrypting it when needed
+// implements walker.MemberOpener
+func (z *Zip) OpenMember(m *walker.Member, path string) (io.ReadCloser, error) {
+	return z.openMember(m.Header.(*zip.File), path)
 }
 
-// Items sends zip files through the channel
-func (z *Zip) Items() chan walker.WalkItem {
-	out := make(chan walker.WalkItem)
-	go func() {
-		for _, item := range z.archive.File {
-			info := item.FileHeader.FileInfo()
-			if !info.IsDir() {
-				z.wg.Add(1) // Remember that we have emitted an Item
-				out <- &Item{
-					FileInfo: info,
-					file:     item,
-					path:     filepath.Join(z.path, item.Name),
-					zip:      z,
-				}
-			}
-		}
-		close(out)
-	}()
-	return out
+// OpenSection gives the content of stored members that aren't encrypted,
+// read directly from the archive
+// implements walker.SectionOpener
+func (z *Zip) OpenSection(m *walker.Member) *io.SectionReader {
+	f := m.Header.(*zip.File)
+	if f.Method != zip.Store || f.Flags&flagEncrypted != 0 {
+		return nil
+	}
+	offset, err := f.DataOffset()
+	if err != nil {
+		return nil
+	}
+	return io.NewSectionReader(z.file, offset, int64(f.UncompressedSize64))
 }
 
-// Item is an item returned by zip.Items.
-type Item struct {
-	zip         *Zip          // Zip archive
-	file        *zip.File     // Item entry
-	os.FileInfo               // Current entry info
-	path        string        // file path made by archive path and file path int the archive
-	rc          io.ReadCloser // The opened reader on the item
+// CheckMember reads the local header of the member
+// implements walker.MemberChecker
+func (z *Zip) CheckMember(m *walker.Member) error {
+	_, err := m.Header.(*zip.File).DataOffset()
+	return err
 }
 
-// MemberName returns archive member name only
-func (i *Item) MemberName() string {
-	return i.path[len(i.zip.path):]
+// MemberMeta gives the archive member header fields, and owners when recorded
+// by Info-ZIP unix extra field
+// implements walker.MemberOpener
+func (z *Zip) MemberMeta(m *walker.Member) walker.Meta {
+	h := m.Header.(*zip.File).FileHeader
+	meta := walker.Meta{}
+	if uid, gid, ok := unixOwner(h.Extra); ok {
+		meta = walker.OwnerMeta(uid, gid)
+	}
+	meta[walker.MetaComment] = h.Comment
+	meta[walker.MetaMethod] = h.Method
+	meta[walker.MetaCompressedSize] = h.CompressedSize64
+	meta[walker.MetaCRC32] = h.CRC32
+	meta[walker.MetaExtra] = h.Extra
+	meta[walker.MetaEncrypted] = h.Flags&flagEncrypted != 0
+	return meta
 }
 
-// FullName returns the item full name relative the folder path used for scanning
-func (i *Item) FullName() string {
-	return i.path
+// openMember gives a reader on the member content, decrypting it when needed
+func (z *Zip) openMember(f *zip.File, path string) (io.ReadCloser, error) {
+	if f.Flags&flagEncrypted == 0 {
+		return f.Open()
+	}
+	return z.decrypt(path, func(password string) (io.ReadCloser, bool, error) {
+		return openEncrypted(f, path, password)
+	})
 }
 
-// Reader give a Reader on the archive Item
-// The reader will be closed when calling Close().
-func (i *Item) Reader() (io.Reader, error) {
-	var err error
-	if i.rc != nil {
-		panic("i.rc not nil at zip.Item.Reader")
+// openEncrypted gives a reader on the content of the encrypted member. It
+// returns false when the password doesn't match the encryption header.
+func openEncrypted(f *zip.File, path, password string) (io.ReadCloser, bool, error) {
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, false, err
 	}
-	if i.rc, err = i.file.Open(); err == nil {
-		// r := encoding.NewReader(i.rc) // translate UTF16 to UTF8
-		return i.rc, nil
+	var r io.Reader
+	var auth *aesReader
+	method := f.Method
+	checkCRC := true
+	if f.Method == methodAES {
+		version, keyLen, m, err := aesParams(f)
+		if err != nil {
+			return nil, false, &walker.Error{Path: path, Op: "decrypt", Err: err}
+		}
+		method = m
+		checkCRC = version == 1 // AE-2 doesn't store CRC
+		salt := make([]byte, keyLen/2)
+		verifier := make([]byte, 2)
+		if _, err = io.ReadFull(raw, salt); err == nil {
+			_, err = io.ReadFull(raw, verifier)
+		}
+		if err != nil {
+			return nil, false, &walker.Error{Path: path, Op: "decrypt", Err: err}
+		}
+		a, ok := newAESReader(f, raw, salt, verifier, keyLen, password)
+		if !ok {
+			return nil, false, nil
+		}
+		r, auth = a, a
+	} else {
+		header := make([]byte, zipCryptoHeader)
+		if _, err = io.ReadFull(raw, header); err != nil {
+			return nil, false, &walker.Error{Path: path, Op: "decrypt", Err: err}
+		}
+		var ok bool
+		if r, ok = newZipCryptoReader(f, raw, header, password); !ok {
+			return nil, false, nil
+		}
 	}
-	return i.rc, err
-}
 
-// Close closes the item's reader, and release it.
-// Closing the zip item permits to close the ZIP container when
-// all items have been closed.
-func (i *Item) Close() {
-	if i.rc != nil {
-		i.rc.Close()
+	var rc io.ReadCloser
+	switch method {
+	case zip.Store:
+		rc = ioutil.NopCloser(r)
+	case zip.Deflate:
+		rc = flate.NewReader(r)
+	default:
+		return nil, false, &walker.Error{Path: path, Op: "decompress", Err: zip.ErrAlgorithm}
 	}
-	i.zip.wg.Done() // Release the item
-}
-
-// String returns the full path
-func (i *Item) String() string {
-	return i.path
+	if checkCRC {
+		rc = struct {
+			io.Reader
+			io.Closer
+		}{&checksumReader{r: rc, hash: crc32.NewIEEE(), want: f.CRC32}, rc}
+	}
+	if auth != nil {
+		rc = &authReader{ReadCloser: rc, auth: auth}
+	}
+	return rc, true, nil
 }
 
-// Clone item
-func (i *Item) Clone() walker.WalkItem {
-	n := &Item{
-		zip:      i.zip,
-		file:     i.file,
-		FileInfo: i.FileInfo,
-		path:     i.path,
+// decrypt tries candidate passwords until one fits. The password that fits
+// is tried first for next members of the archive.
+// A wrong password passes the encryption header check now and then: when
+// there are several candidates, the content is checked before accepting one,
+// until a password has fit. Otherwise a wrong password is reported when the
+// content is read.
+func (z *Zip) decrypt(path string, try func(password string) (io.ReadCloser, bool, error)) (io.ReadCloser, error) {
+	candidates := z.keyring.Candidates()
+	verify := len(candidates) > 1 && !z.keyring.Promoted()
+	for _, password := range candidates {
+		r, ok, err := try(password)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if verify {
+			_, err = io.Copy(ioutil.Discard, r)
+			r.Close()
+			if err != nil {
+				continue
+			}
+			if r, _, err = try(password); err != nil {
+				return nil, err
+			}
+		}
+		z.keyring.Promote(password)
+		return &passwordReader{ReadCloser: r, path: path}, nil
 	}
-	i.zip.wg.Add(1) // Remember that we have emitted an Item
-	return n
+	return nil, &walker.Error{Path: path, Op: "decrypt", Err: walker.ErrPassword}
 }
@@ -1,11 +1,23 @@
 package zipwalker
 
 import (
-	"bufio"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/walker"
+	"github.com/simulot/golib/file/walker/walkertest"
 )
 
 func TestOpenZipFolder(t *testing.T) {
@@ -25,75 +37,424 @@ func TestOpenZipFolder(t *testing.T) {
 
 }
 
-var testZipFolderCases = []struct {
-	path     string
-	expected []string
-}{
-	{
-		"test/flat.zip",
-		[]string{
-			"test/flat.zip/file_a.txt", "test/flat.zip/file_b.txt", "test/flat.zip/file_c.txt",
-			"test/flat.zip/file_d.txt", "test/flat.zip/file_e.txt", "test/flat.zip/file_f.txt",
-		},
-	},
-	{
-		"test/tree.zip",
-		[]string{
-			"test/tree.zip/file_a.txt", "test/tree.zip/file_b.txt", "test/tree.zip/file_c.txt",
-			"test/tree.zip/subtree/file_d.txt", "test/tree.zip/subtree/file_e.txt", "test/tree.zip/subtree/file_f.txt",
-		},
-	},
+func TestZip(t *testing.T) {
+	meta := []string{walker.MetaCRC32, walker.MetaMethod}
+	walkertest.Archive(t, Open,
+		walkertest.Case{Path: "test/flat.zip", Names: walkertest.FlatNames, Meta: meta},
+		walkertest.Case{Path: "test/tree.zip", Names: walkertest.TreeNames, Meta: meta},
+	)
+}
+
+func TestZipImpliedDirs(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, name := range []string{"b/c/file_1.txt", "a.txt"} {
+		if _, err := w.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	name := filepath.Join(t.TempDir(), "implied.zip")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	z, err := Open(name, walker.Dirs(walker.DirsPreOrder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	dirs := []bool{}
+	for item := range z.Items() {
+		got = append(got, filepath.ToSlash(item.MemberName()))
+		dirs = append(dirs, item.IsDir())
+		item.Close()
+	}
+	z.Close()
+	expected := []string{"/a.txt", "/b", "/b/c", "/b/c/file_1.txt"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %#q, but got %#q", expected, got)
+	}
+	if !reflect.DeepEqual(dirs, []bool{false, true, true, false}) {
+		t.Errorf("Expected implied entries to be directories, but got %v", dirs)
+	}
 }
 
-func TestZipFolders(t *testing.T) {
+func mustZipReader(t *testing.T, b []byte) *zip.Reader {
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
 
-	for _, c := range testZipFolderCases {
-		folder, err := Open(c.path)
+func TestZipCorruptedEntry(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, name := range []string{"file_a.txt", "file_b.txt", "file_c.txt"} {
+		f, err := w.Create(name)
 		if err != nil {
-			t.Errorf("Unexpected error %s", err)
-			break
+			t.Fatal(err)
+		}
+		f.Write([]byte(name + "\n"))
+	}
+	w.Close()
+	b := buf.Bytes()
+
+	// Damage local header signature of file_b.txt
+	r := mustZipReader(t, b)
+	offset, err := r.File[1].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[offset-30-int64(len("file_b.txt"))] = 'X'
+
+	name := filepath.Join(t.TempDir(), "corrupted.zip")
+	if err := ioutil.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, skip := range []bool{true, false} {
+		log := new(bytes.Buffer)
+		opts := []walker.Option{walker.WithLogger(slog.New(slog.NewTextHandler(log, nil)))}
+		if skip {
+			opts = append(opts, walker.OnError(walker.SkipErrors))
+		}
+		z, err := Open(name, opts...)
+		if err != nil {
+			t.Fatal(err)
 		}
 		got := []string{}
-		for f := range folder.Items() {
-			got = append(got, f.FullName())
-			f.Close()
+		for item := range z.Items() {
+			got = append(got, item.Name())
+			item.Close()
+		}
+		z.Close()
+		expected := []string{"file_a.txt"}
+		if skip {
+			expected = append(expected, "file_c.txt")
+			if z.Err() != nil {
+				t.Errorf("Unexpected error %s", z.Err())
+			}
+			if !strings.Contains(log.String(), "member=file_b.txt stage=\"read header\"") {
+				t.Errorf("Expecting file_b.txt to be logged, but got %q", log.String())
+			}
+		} else if e, ok := z.Err().(*walker.Error); !ok || e.Path != filepath.Join(name, "file_b.txt") {
+			t.Errorf("Expecting an error on file_b.txt, but got %v", z.Err())
 		}
-		if len(got) != len(c.expected) {
-			t.Errorf("Expected file count %d, but got %d", len(c.expected), len(got))
-			break
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expecting %#q, but got %#q", expected, got)
 		}
-		sort.Strings(got)
-		sort.Strings(c.expected)
-		if !reflect.DeepEqual(c.expected, got) {
-			t.Errorf("Expected %#q, but got %#q", c.expected, got)
-			break
+	}
+}
 
+func TestZipEscapingNames(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, name := range []string{"../../../../e.txt", "/abs/f.txt", "./"} {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
 		}
-		folder.Close()
+		f.Write([]byte(filepath.Base(name) + "\n"))
+	}
+	w.Close()
+	name := filepath.Join(t.TempDir(), "escape.zip")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	z, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for item := range z.Items() {
+		if !strings.HasPrefix(item.FullName(), name+string(filepath.Separator)) {
+			t.Errorf("Expected '%s' to be inside the archive", item.FullName())
+		}
+		got = append(got, filepath.ToSlash(item.MemberName()))
+		walkertest.CheckContent(t, item)
+		item.Close()
+	}
+	z.Close()
+	sort.Strings(got)
+	if expected := []string{"/abs/f.txt", "/e.txt"}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %#q, but got %#q", expected, got)
+	}
+}
 
+func TestOpenPath(t *testing.T) {
+	for _, path := range []string{"test/tree.zip/subtree/file_d.txt", "test/flat.zip/file_b.txt", "../test/tree/file_c.txt"} {
+		item, err := walker.OpenPath(path)
+		if err != nil {
+			t.Errorf("Unexpected error %s for '%s'", err, path)
+			continue
+		}
+		if item.FullName() != filepath.FromSlash(path) {
+			t.Errorf("Expected full name '%s', but got '%s'", path, item.FullName())
+		}
+		walkertest.CheckContent(t, item)
+		item.Close()
+	}
+	for _, path := range []string{"test/tree.zip/subtree/file_a.txt", "test/nowhere.zip/file_a.txt", "../test/tree/nowhere.txt"} {
+		if _, err := walker.OpenPath(path); !os.IsNotExist(err) {
+			t.Errorf("Expected not exist error for '%s', but got %v", path, err)
+		}
 	}
 }
 
-func TestZipFolderItemOpen(t *testing.T) {
-	for _, c := range testZipFolderCases {
-		folder, err := Open(c.path)
+func TestOpenPathNested(t *testing.T) {
+	inner, err := ioutil.ReadFile("test/tree.zip")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	outer := filepath.Join(t.TempDir(), "outer.zip")
+	f, err := os.Create(outer)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("archives/tree.zip")
+	w.Write(inner)
+	zw.Close()
+	f.Close()
+
+	path := filepath.Join(outer, "archives", "tree.zip", "subtree", "file_d.txt")
+	item, err := walker.OpenPath(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if item.FullName() != path {
+		t.Errorf("Expected full name '%s', but got '%s'", path, item.FullName())
+	}
+	walkertest.CheckContent(t, item)
+	item.Close()
+	item.Close() // Closing twice is harmless
+
+	path = filepath.Join(outer, "archives", "tree.zip", "subtree", "file_a.txt")
+	if _, err := walker.OpenPath(path); !os.IsNotExist(err) {
+		t.Errorf("Expected not exist error for '%s', but got %v", path, err)
+	}
+
+	path = filepath.Join(outer, "archives", "tree.zip", "file_a.txt")
+	if _, err := walker.OpenPath(path, walker.SpoolLimit(int64(len(inner)-1))); errors.Cause(err) != walker.ErrTooLarge {
+		t.Errorf("Expected ErrTooLarge for '%s', but got %v", path, err)
+	}
+}
+
+func TestZipCloseWait(t *testing.T) {
+	w, err := Open("test/flat.zip", walker.LeakDetection())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	z := w.(*Zip)
+	var kept walker.WalkItem
+	for item := range z.Items() {
+		if item.Name() == "file_c.txt" {
+			kept = item
+			continue
+		}
+		item.Close()
+		item.Close() // Closing twice is harmless
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = z.CloseWait(ctx)
+	leak, ok := err.(*walker.LeakError)
+	if !ok {
+		t.Fatalf("Expected a leak error, but got %v", err)
+	}
+	if len(leak.Items) != 1 || leak.Items[0].Name != filepath.Join("test/flat.zip", "file_c.txt") {
+		t.Errorf("Expected file_c.txt to be reported, but got %#v", leak.Items)
+	}
+	if !strings.Contains(leak.Items[0].Stack, "walker.(*Archive).Items") {
+		t.Errorf("Expected emission stack, but got %s", leak.Items[0].Stack)
+	}
+
+	go kept.Close()
+	if err = z.CloseWait(context.Background()); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	if _, err = z.file.Stat(); err == nil {
+		t.Errorf("Expected archive to be closed")
+	}
+}
+
+func TestZipItemOpen(t *testing.T) {
+	w, err := Open("test/flat.zip")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	z := w.(*Zip)
+	readers := []io.ReadCloser{}
+	for item := range z.Items() {
+		for n := 0; n < 2; n++ {
+			r, err := item.Open()
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			readers = append(readers, r)
+		}
+		// Reader can be called more than once
+		walkertest.CheckContent(t, item)
+		walkertest.CheckContent(t, item)
+		item.Close()
+	}
+
+	// Readers outlive items and walker closing
+	z.Close()
+	for _, r := range readers {
+		content, err := ioutil.ReadAll(r)
+		if err != nil || len(content) != len("file_a.txt\n") {
+			t.Errorf("Unexpected content '%s', error %v", content, err)
+		}
+		r.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = z.CloseWait(ctx); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+}
+
+func TestZipOpenRandom(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, h := range []*zip.FileHeader{{Name: "stored.txt", Method: zip.Store}, {Name: "deflated.txt", Method: zip.Deflate}} {
+		f, err := w.CreateHeader(h)
 		if err != nil {
-			t.Errorf("Unexpected error %s", err)
-			break
+			t.Fatal(err)
 		}
-		for item := range folder.Items() {
-			reader, err := item.Reader()
+		f.Write([]byte(content))
+	}
+	w.Close()
+	name := filepath.Join(t.TempDir(), "random.zip")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, limit := range []int64{walker.DefaultSpoolLimit, 10} {
+		z, err := Open(name, walker.SpoolLimit(limit))
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		for item := range z.Items() {
+			r, err := item.(walker.RandomAccess).OpenRandom()
+			if limit == 10 && item.Name() == "deflated.txt" {
+				if errors.Cause(err) != walker.ErrTooLarge {
+					t.Errorf("Expected ErrTooLarge, but got %v", err)
+				}
+				item.Close()
+				continue
+			}
 			if err != nil {
-				t.Errorf("Unexpected error when opening '%s' from '%s'", item.FullName(), c.path)
-				return
+				t.Fatalf("Unexpected error %s", err)
 			}
-			content, err := bufio.NewReader(reader).ReadString('\n')
-			content = strings.TrimRight(content, "\n")
-			if content != item.Name() {
-				t.Errorf("Expected content of '%s' file to by '%s', but got '%s'!", item.Name(), item.Name(), content)
+			b := make([]byte, 5)
+			if _, err = r.ReadAt(b, 993); err != nil || string(b) != "34567" {
+				t.Errorf("ReadAt on '%s', expected '34567', but got '%s', %v", item.Name(), b, err)
 			}
+			if _, err = r.Seek(-3, io.SeekEnd); err != nil {
+				t.Errorf("Unexpected error %s", err)
+			}
+			if b, err = ioutil.ReadAll(r); err != nil || string(b) != "789" {
+				t.Errorf("Seek on '%s', expected '789', but got '%s', %v", item.Name(), b, err)
+			}
+			r.Close()
 			item.Close()
 		}
-		folder.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err = z.(*Zip).CloseWait(ctx); err != nil {
+			t.Errorf("Unexpected error %s", err)
+		}
+		cancel()
+	}
+}
+
+func TestZipRawAndTextReaders(t *testing.T) {
+	utf16 := []byte("\xff\xfeH\x00i\x00!\x00")
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	f, err := w.Create("utf16.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(utf16)
+	w.Close()
+	name := filepath.Join(t.TempDir(), "utf16.zip")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := walker.OpenPath(filepath.Join(name, "utf16.txt"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer item.Close()
+	raw, err := item.RawReader()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if got, _ := ioutil.ReadAll(raw); !bytes.Equal(got, utf16) {
+		t.Errorf("Expected raw content %q, but got %q", utf16, got)
+	}
+	text, err := item.TextReader()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if got, _ := ioutil.ReadAll(text); string(got) != "Hi!" {
+		t.Errorf("Expected text content 'Hi!', but got %q", got)
+	}
+	legacy, err := item.Reader()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if got, _ := ioutil.ReadAll(legacy); !bytes.Equal(got, utf16) {
+		t.Errorf("Expected Reader to give raw content %q, but got %q", utf16, got)
+	}
+}
+
+func TestZipMeta(t *testing.T) {
+	item, err := walker.OpenPath("test/tree.zip/subtree/file_e.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer item.Close()
+	m := item.Meta()
+	expected := map[string]interface{}{
+		walker.MetaUID:            1000,
+		walker.MetaGID:            1000,
+		walker.MetaMethod:         zip.Store,
+		walker.MetaCompressedSize: uint64(11),
+		walker.MetaEncrypted:      false,
+		walker.MetaComment:        "",
+	}
+	for k, v := range expected {
+		if m[k] != v {
+			t.Errorf("Expected meta %s to be %v, but got %v", k, v, m[k])
+		}
+	}
+	if _, ok := m[walker.MetaCRC32].(uint32); !ok {
+		t.Errorf("Expected CRC32 in meta, but got %v", m[walker.MetaCRC32])
+	}
+}
+
+func TestUnixOwner(t *testing.T) {
+	cases := []struct {
+		extra    []byte
+		uid, gid int
+		ok       bool
+	}{
+		{[]byte("\x55\x54\x05\x00\x03\x0d\x34\x27\x58\x75\x78\x0b\x00\x01\x04\xe8\x03\x00\x00\x04\xe8\x03\x00\x00"), 1000, 1000, true},
+		{[]byte("\x75\x78\x05\x00\x01\x01\x00\x01\x02"), 0, 2, true},
+		{[]byte("\x75\x78\x05\x00\x01\x04\x00\x01\x02"), 0, 0, false},
+		{[]byte("\x55\x54\x05\x00\x03\x0d\x34\x27\x58"), 0, 0, false},
+	}
+	for _, c := range cases {
+		uid, gid, ok := unixOwner(c.extra)
+		if uid != c.uid || gid != c.gid || ok != c.ok {
+			t.Errorf("For %q, expected %d, %d, %v, but got %d, %d, %v", c.extra, c.uid, c.gid, c.ok, uid, gid, ok)
+		}
 	}
 }
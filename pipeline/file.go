@@ -1,11 +1,11 @@
 package pipeline
 
 import (
-	"fmt"
+	"path"
+	"strings"
 
 	"path/filepath"
 
-	"github.com/pkg/errors"
 	"github.com/simulot/golib/file/walker"
 )
 
@@ -14,7 +14,8 @@ import (
 //
 // IN: chan string : wildcarded names
 // OUT: chan string : list of actual files correspondind to wildwards
-func GlobOperator() Operator {
+func GlobOperator(opts ...Option) Operator {
+	o := newOptions(opts...)
 	return func(in, out chan interface{}) {
 		for i := range in {
 			if s, ok := i.(string); !ok {
@@ -22,7 +23,7 @@ func GlobOperator() Operator {
 			} else {
 				paths, err := filepath.Glob(s)
 				if err != nil {
-					fmt.Println(err)
+					o.logger.Error("Can't expand pattern", "stage", "glob", "pattern", s, "error", err)
 				}
 				if paths != nil {
 					for _, p := range paths {
@@ -38,18 +39,17 @@ func GlobOperator() Operator {
 // and transforms it into a walker
 // IN string
 // OUT walker.Walker
-func FolderToWalkersOperator() Operator {
+func FolderToWalkersOperator(opts ...Option) Operator {
+	o := newOptions(opts...)
 	return func(in, out chan interface{}) {
 		for i := range in {
 			if path, ok := i.(string); ok {
 				w, err := walker.Open(path)
 				if err != nil {
-					fmt.Println(err)
+					o.logger.Error("Can't open walker", "stage", "open", "file", path, "error", err)
 					continue
 				}
-				for item := range w.Items() {
-					out <- walker.Walker(item)
-				}
+				out <- walker.Walker(w)
 			} else {
 				panic("Expecting string in FolderToWalkersOperator")
 			}
@@ -60,7 +60,8 @@ func FolderToWalkersOperator() Operator {
 // WalkOperator is an operator that walks through walker's items
 // IN walker.Walker
 // OUT waker.Items
-func WalkOperator() Operator {
+func WalkOperator(opts ...Option) Operator {
+	o := newOptions(opts...)
 	return func(in, out chan interface{}) {
 		for i := range in {
 			if w, ok := i.(walker.Walker); ok {
@@ -68,6 +69,9 @@ func WalkOperator() Operator {
 					out <- item
 				}
 				w.Close()
+				if err := w.Err(); err != nil {
+					o.logger.Error("Walk aborted", "stage", "walk", "error", err)
+				}
 			} else {
 				panic("Expecting Walker in WalkOperator")
 			}
@@ -78,13 +82,15 @@ func WalkOperator() Operator {
 // FileMaskOperator filter a channel of walker.WalkItem items using a file mask
 // IN : chan walker.WalkItem
 // OUT : chan walker.WalkItem
-func FileMaskOperator(mask string) Operator {
+func FileMaskOperator(mask string, opts ...Option) Operator {
+	o := newOptions(opts...)
 	return func(in, out chan interface{}) {
 		for i := range in {
 			if item, ok := i.(walker.WalkItem); ok {
 				match, err := filepath.Match(mask, item.Name())
 				if err != nil {
-					fmt.Println(errors.Wrapf(err, "Can't use mask in FileMaskOperator"))
+					o.logger.Error("Can't use mask", "stage", "mask", "file", item.FullName(), "mask", mask, "error", err)
+					item.Close()
 					continue
 				}
 				if match {
@@ -119,6 +125,42 @@ func FileFilterOperator(filter func(walker.WalkItem) bool) Operator {
 	}
 }
 
+// TextFilterOperator filter a channel of walker.WalkItem items, keeping
+// only text files. The content is sniffed on its first sniffLen bytes,
+// or encoding.DefaultSniffLen when sniffLen isn't positive.
+// IN : chan walker.WalkItem
+// OUT : chan walker.WalkItem
+func TextFilterOperator(sniffLen int) Operator {
+	return FileFilterOperator(func(item walker.WalkItem) bool {
+		return walker.IsText(item, sniffLen)
+	})
+}
+
+// ContentTypeOperator filter a channel of walker.WalkItem items by their
+// content type. Patterns are matched against the MIME type without its
+// parameters, like "image/*" or "text/plain".
+// IN : chan walker.WalkItem
+// OUT : chan walker.WalkItem
+func ContentTypeOperator(patterns []string, opts ...Option) Operator {
+	o := newOptions(opts...)
+	return FileFilterOperator(func(item walker.WalkItem) bool {
+		ct, err := walker.ContentType(item)
+		if err != nil {
+			o.logger.Error("Can't sniff content type", "stage", "content-type", "file", item.FullName(), "error", err)
+			return false
+		}
+		if i := strings.IndexByte(ct, ';'); i >= 0 {
+			ct = ct[:i]
+		}
+		for _, p := range patterns {
+			if match, _ := path.Match(p, ct); match {
+				return true
+			}
+		}
+		return false
+	})
+}
+
 /*
 type deDuplicate struct {
 	sync.Mutex
@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/simulot/golib/file/walker"
+)
+
+// writeFiles writes files under dir, creating their folders
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// walkNames runs the operator over the items of the folder, and gives the
+// sorted names of the items kept, relative to the folder
+func walkNames(t *testing.T, dir string, op Operator) []string {
+	in := make(chan interface{}, 1)
+	in <- dir
+	close(in)
+	got := []string{}
+	for i := range NewFlow(FolderToWalkersOperator(), WalkOperator(), op).Run(in) {
+		item := i.(walker.WalkItem)
+		got = append(got, filepath.ToSlash(item.FullName()[len(dir)+1:]))
+		item.Close()
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestTextFilterOperator(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"readme.txt":    "Hello\n",
+		"latin1.txt":    "Caf\xe9\n",
+		"utf16.txt":     "\xff\xfeH\x00i\x00",
+		"image.png":     "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"photo.jpg":     "\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00",
+		"sub/notes.md":  "# Notes\n",
+		"sub/empty.txt": "",
+	})
+	expected := []string{"latin1.txt", "readme.txt", "sub/empty.txt", "sub/notes.md", "utf16.txt"}
+	if got := walkNames(t, dir, TextFilterOperator(0)); !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %#q, but got %#q", expected, got)
+	}
+}
+
+func TestContentTypeOperator(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"readme.txt":   "Hello\n",
+		"page.html":    "<html><body>Hi</body></html>",
+		"image.png":    "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"photo.jpg":    "\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00",
+		"sub/gone.gif": "GIF89a",
+	})
+	cases := []struct {
+		patterns []string
+		expected []string
+	}{
+		{[]string{"image/*"}, []string{"image.png", "photo.jpg", "sub/gone.gif"}},
+		{[]string{"text/plain", "text/html"}, []string{"page.html", "readme.txt"}},
+		{[]string{"video/*"}, []string{}},
+	}
+	for _, c := range cases {
+		if got := walkNames(t, dir, ContentTypeOperator(c.patterns)); !reflect.DeepEqual(c.expected, got) {
+			t.Errorf("Expected %#q for %#q, but got %#q", c.expected, c.patterns, got)
+		}
+	}
+
+	// Items that can't be read are dropped and reported
+	w, err := walker.Open(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	in := make(chan interface{}, 10)
+	for item := range w.Items() {
+		in <- item
+	}
+	close(in)
+	w.Close()
+	if err = os.Remove(filepath.Join(dir, "sub", "gone.gif")); err != nil {
+		t.Fatal(err)
+	}
+	log := new(bytes.Buffer)
+	got := []string{}
+	for i := range ContentTypeOperator([]string{"image/*"}, WithLogger(slog.New(slog.NewTextHandler(log, nil)))).Run(in) {
+		item := i.(walker.WalkItem)
+		got = append(got, item.Name())
+		item.Close()
+	}
+	sort.Strings(got)
+	if expected := []string{"image.png", "photo.jpg"}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %#q, but got %#q", expected, got)
+	}
+	if !strings.Contains(log.String(), "gone.gif") || !strings.Contains(log.String(), "stage=content-type") {
+		t.Errorf("Expected the unreadable item to be reported, but got %q", log.String())
+	}
+}
@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"log/slog"
+
+	"github.com/simulot/golib/file/encoding"
+)
+
+// Option configures operators
+type Option func(*options)
+
+type options struct {
+	logger      *slog.Logger
+	textOptions []encoding.Option
+}
+
+// WithLogger set the logger receiving operator errors. By default, errors go
+// to slog default logger, tagged with component=pipeline.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// TextOptions set the options used by operators reading text, like
+// encoding.NormalizeNewlines
+func TextOptions(opts ...encoding.Option) Option {
+	return func(o *options) {
+		o.textOptions = append(o.textOptions, opts...)
+	}
+}
+
+func newOptions(opts ...Option) options {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.logger == nil {
+		o.logger = slog.Default().With("component", "pipeline")
+	}
+	return o
+}
@@ -0,0 +1,212 @@
+package pipeline
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/simulot/golib/file/encoding"
+	"github.com/simulot/golib/file/walker"
+	"github.com/simulot/golib/file/walker/zipwalker"
+	textencoding "golang.org/x/text/encoding"
+)
+
+// Destination receives the files written by TranscodeOperator
+type Destination interface {
+	Create(item walker.WalkItem) (io.WriteCloser, error) // Give the writer of the item's new content
+}
+
+// ErrCollision is returned when two items go to the same destination path
+var ErrCollision = errors.New("Already written")
+
+// names gives the destination path of items, relative to the walk root.
+// Each path is given once.
+type names struct {
+	src  string // walk root
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newNames(src string) *names {
+	return &names{src: src, seen: map[string]bool{}}
+}
+
+// name gives the slash separated path of the item under the walk root,
+// archive paths included, like "docs/a.zip/b.txt"
+func (n *names) name(item walker.WalkItem) (string, error) {
+	rel, err := filepath.Rel(n.src, item.FullName())
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", errors.Errorf("Can't place '%s' outside of '%s'", item.FullName(), n.src)
+	}
+	if rel == "." {
+		rel = filepath.Base(n.src)
+	}
+	name := filepath.ToSlash(rel)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.seen[name] {
+		return "", &os.PathError{Op: "create", Path: name, Err: ErrCollision}
+	}
+	n.seen[name] = true
+	return name, nil
+}
+
+// folderDestination writes files into a folder
+type folderDestination struct {
+	root  string
+	names *names
+}
+
+// FolderDestination writes files under root, at their path relative to src,
+// the walk root. Members of archives go into a folder named after the
+// archive. Missing directories are created. Two items going to the same
+// path give an ErrCollision.
+func FolderDestination(src, root string) Destination {
+	return &folderDestination{root: root, names: newNames(src)}
+}
+
+// Create creates the item's file, replacing an existing one
+func (d *folderDestination) Create(item walker.WalkItem) (io.WriteCloser, error) {
+	name, err := d.names.name(item)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(d.root, filepath.FromSlash(name))
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrapf(err, "Can't create folder for '%s'", path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, item.Mode().Perm()|0200)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can't create '%s'", path)
+	}
+	return f, nil
+}
+
+// zipDestination writes files as members of a zip archive
+type zipDestination struct {
+	mu    sync.Mutex // held while a member is written
+	w     *zipwalker.Writer
+	names *names
+}
+
+// ZipDestination writes files as members of the archive, named after their
+// path relative to src, the walk root. Members are written one at a time,
+// even when operators run in parallel. Two items going to the same name give
+// an ErrCollision. The archive must be closed by the caller once the flow is
+// done.
+func ZipDestination(src string, w *zipwalker.Writer) Destination {
+	return &zipDestination{w: w, names: newNames(src)}
+}
+
+// Create adds the item's member. The archive is locked until the returned
+// writer is closed.
+func (d *zipDestination) Create(item walker.WalkItem) (io.WriteCloser, error) {
+	name, err := d.names.name(item)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	f, err := d.w.CreateAs(item, name)
+	if err != nil {
+		d.mu.Unlock()
+		return nil, err
+	}
+	return &zipMember{Writer: f, unlock: d.mu.Unlock}, nil
+}
+
+// zipMember releases the archive when closed
+type zipMember struct {
+	io.Writer
+	unlock func()
+	once   sync.Once
+}
+
+func (m *zipMember) Close() error {
+	m.once.Do(m.unlock)
+	return nil
+}
+
+// Transcoded reports the conversion of a file by TranscodeOperator
+type Transcoded struct {
+	Name   string          // Full name of the source item
+	Source encoding.Result // Charset detected in the source. Binary files are copied as is
+	Err    error           // Error that has stopped the conversion
+}
+
+// String gives the file name with its source charset
+func (t Transcoded) String() string {
+	switch {
+	case t.Err != nil:
+		return t.Name + ": " + t.Err.Error()
+	case t.Source.IsBinary:
+		return t.Name + " (binary)"
+	}
+	return t.Name + " (" + t.Source.Name + ")"
+}
+
+// TranscodeOperator converts text files into the target encoding, UTF-8
+// when nil, and writes them into the destination. The output starts with a
+// BOM when the target encoder writes one, like unicode.UTF8BOM. The source
+// charset is detected by the encoding package. Binary files are copied as
+// is, and directories are dropped. Items are closed once written.
+// IN : chan walker.WalkItem
+// OUT : chan Transcoded
+func TranscodeOperator(dst Destination, target textencoding.Encoding, opts ...Option) Operator {
+	o := newOptions(opts...)
+	return func(in, out chan interface{}) {
+		for i := range in {
+			item, ok := i.(walker.WalkItem)
+			if !ok {
+				panic("Expecting walker.WalkItem in TranscodeOperator")
+			}
+			if item.IsDir() {
+				item.Close()
+				continue
+			}
+			report := transcode(item, dst, target, o)
+			item.Close()
+			if report.Err != nil {
+				o.logger.Error("Can't transcode", "stage", "transcode", "file", report.Name, "error", report.Err)
+			} else {
+				o.logger.Debug("File transcoded", "stage", "transcode", "file", report.Name, "encoding", report.Source.Name, "binary", report.Source.IsBinary)
+			}
+			out <- report
+		}
+	}
+}
+
+// transcode writes the item content into the destination
+func transcode(item walker.WalkItem, dst Destination, target textencoding.Encoding, o options) Transcoded {
+	report := Transcoded{Name: item.FullName()}
+	r, err := item.TextReader(append([]encoding.Option{encoding.Detected(&report.Source)}, o.textOptions...)...)
+	if err != nil {
+		report.Err = errors.Wrapf(err, "Can't read '%s'", report.Name)
+		return report
+	}
+	f, err := dst.Create(item)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	defer func() {
+		if err := f.Close(); err != nil && report.Err == nil {
+			report.Err = errors.Wrapf(err, "Can't write '%s'", report.Name)
+		}
+	}()
+	w := io.Writer(f)
+	if !report.Source.IsBinary {
+		enc := encoding.NewWriter(f, target, target != nil && encoding.WritesBOM(target))
+		defer func() {
+			if err := enc.Close(); err != nil && report.Err == nil {
+				report.Err = errors.Wrapf(err, "Can't write '%s'", report.Name)
+			}
+		}()
+		w = enc
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		report.Err = errors.Wrapf(err, "Can't transcode '%s'", report.Name)
+	}
+	return report
+}
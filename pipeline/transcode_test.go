@@ -0,0 +1,203 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/simulot/golib/file/walker/zipwalker"
+	textencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// writeZip writes a zip archive of the named contents
+func writeZip(t *testing.T, path string, files map[string]string) {
+	buf := new(bytes.Buffer)
+	z := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const photo = "\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00"
+
+// writeSources writes files of mixed encodings, and two archives having
+// members of the same name
+func writeSources(t *testing.T) string {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"readme.txt":     "Hello\n",
+		"latin1.txt":     "Caf\xe9\n",
+		"sub/utf16.txt":  "\xff\xfeH\x00i\x00",
+		"sub/photo.jpg":  photo,
+		"sub/empty.txt":  "",
+		"sub/sub/ok.txt": "d\xc3\xa9j\xc3\xa0\n",
+	})
+	writeZip(t, filepath.Join(dir, "a.zip"), map[string]string{"notes.txt": "d\xe9j\xe0\n"})
+	writeZip(t, filepath.Join(dir, "sub", "b.zip"), map[string]string{"notes.txt": "na\xefve\n"})
+	return dir
+}
+
+// transcodedFiles gives the UTF-8 content expected from the sources
+var transcodedFiles = map[string]string{
+	"readme.txt":          "Hello\n",
+	"latin1.txt":          "Café\n",
+	"sub/utf16.txt":       "Hi",
+	"sub/photo.jpg":       photo,
+	"sub/empty.txt":       "",
+	"sub/sub/ok.txt":      "déjà\n",
+	"a.zip/notes.txt":     "déjà\n",
+	"sub/b.zip/notes.txt": "naïve\n",
+}
+
+// transcodeFlow runs TranscodeOperator over the items of the sources, and
+// gives the reports by file name relative to the first source. The second
+// report on a name is suffixed with " (again)".
+func transcodeFlow(t *testing.T, sources []string, dst Destination, target textencoding.Encoding) map[string]Transcoded {
+	in := make(chan interface{}, len(sources))
+	for _, s := range sources {
+		in <- s
+	}
+	close(in)
+	reports := map[string]Transcoded{}
+	for i := range NewFlow(FolderToWalkersOperator(), WalkOperator(), TranscodeOperator(dst, target)).Run(in) {
+		r := i.(Transcoded)
+		rel, err := filepath.Rel(sources[0], r.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.ToSlash(rel)
+		if _, ok := reports[name]; ok {
+			name += " (again)"
+		}
+		reports[name] = r
+	}
+	return reports
+}
+
+// checkReports checks the source charsets reported
+func checkReports(t *testing.T, reports map[string]Transcoded) {
+	expected := map[string]string{
+		"readme.txt":          "UTF-8",
+		"latin1.txt":          "ISO-8859-1",
+		"sub/utf16.txt":       "UTF-16LE",
+		"sub/photo.jpg":       "",
+		"sub/sub/ok.txt":      "UTF-8",
+		"a.zip/notes.txt":     "ISO-8859-1",
+		"sub/b.zip/notes.txt": "ISO-8859-1",
+	}
+	for name, charset := range expected {
+		r, ok := reports[name]
+		switch {
+		case !ok:
+			t.Errorf("Expected a report on '%s'", name)
+		case r.Err != nil:
+			t.Errorf("Unexpected error on '%s': %s", name, r.Err)
+		case r.Source.Name != charset || r.Source.IsBinary != (charset == ""):
+			t.Errorf("Expected '%s' to be %q, but got %q, binary %v", name, charset, r.Source.Name, r.Source.IsBinary)
+		}
+	}
+}
+
+func TestTranscodeToFolder(t *testing.T) {
+	src, dst := writeSources(t), t.TempDir()
+	checkReports(t, transcodeFlow(t, []string{src}, FolderDestination(src, dst), nil))
+	for name, expected := range transcodedFiles {
+		got, err := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil || string(got) != expected {
+			t.Errorf("Expected '%s' to contain %q, but got %q, %v", name, expected, got, err)
+		}
+	}
+}
+
+func TestTranscodeToZip(t *testing.T) {
+	src := writeSources(t)
+	buf := new(bytes.Buffer)
+	w := zipwalker.NewWriter(buf)
+	checkReports(t, transcodeFlow(t, []string{src}, ZipDestination(src, w), nil))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, f := range mustZip(t, buf.Bytes()).File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(b)
+	}
+	if !reflect.DeepEqual(transcodedFiles, got) {
+		t.Errorf("Expected members %q, but got %q", transcodedFiles, got)
+	}
+}
+
+func mustZip(t *testing.T, b []byte) *zip.Reader {
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestTranscodeBOM(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{"bom.txt": "\xef\xbb\xbfHi\n", "latin1.txt": "Caf\xe9\n"})
+	cases := []struct {
+		target   textencoding.Encoding
+		expected map[string]string
+	}{
+		{nil, map[string]string{"bom.txt": "Hi\n", "latin1.txt": "Café\n"}},
+		{unicode.UTF8BOM, map[string]string{"bom.txt": "\uFEFFHi\n", "latin1.txt": "\uFEFFCafé\n"}},
+		{unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), map[string]string{"bom.txt": "\xff\xfeH\x00i\x00\n\x00", "latin1.txt": "\xff\xfeC\x00a\x00f\x00\xe9\x00\n\x00"}},
+		{unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), map[string]string{"bom.txt": "H\x00i\x00\n\x00", "latin1.txt": "C\x00a\x00f\x00\xe9\x00\n\x00"}},
+	}
+	for _, c := range cases {
+		transcodeFlow(t, []string{src}, FolderDestination(src, dst), c.target)
+		for name, expected := range c.expected {
+			got, err := ioutil.ReadFile(filepath.Join(dst, name))
+			if err != nil || string(got) != expected {
+				t.Errorf("Expected '%s' to contain %q with %v, but got %q, %v", name, expected, c.target, got, err)
+			}
+		}
+	}
+}
+
+func TestTranscodeCollision(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	// The same folder walked twice goes twice to the same paths
+	reports := transcodeFlow(t, []string{src, src}, FolderDestination(src, dst), nil)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if r := reports[name]; r.Err != nil {
+			t.Errorf("Unexpected error on '%s': %s", name, r.Err)
+		}
+		if r := reports[name+" (again)"]; !errors.Is(r.Err, ErrCollision) {
+			t.Errorf("Expected a collision on '%s', but got %v", name, r.Err)
+		}
+	}
+
+	reports = transcodeFlow(t, []string{src}, FolderDestination(filepath.Join(src, "other"), dst), nil)
+	if r := reports["a.txt"]; r.Err == nil {
+		t.Errorf("Expected an error on an item outside of the walk root")
+	}
+}